@@ -0,0 +1,123 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var SchemeGroupVersion = schema.GroupVersion{Group: "vaultlink.jamhed.github.io", Version: "v1alpha1"}
+
+var VaultBindingResource = SchemeGroupVersion.WithResource("vaultbindings")
+
+const (
+	ConditionReady    = "Ready"
+	ConditionDegraded = "Degraded"
+)
+
+// VaultBinding binds its namespace to vault, it is an alternative to vault-link/bind namespace annotation.
+type VaultBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VaultBindingSpec   `json:"spec"`
+	Status VaultBindingStatus `json:"status,omitempty"`
+}
+
+// ServiceAccount gets a vault role of the namespace auth mount, it is also the item
+// of vault-link/service-accounts namespace annotation in JSON form.
+type ServiceAccount struct {
+	Name            string           `json:"name"`
+	BoundNamespaces []string         `json:"boundNamespaces,omitempty"`
+	Policies        []string         `json:"policies,omitempty"`
+	TokenTTL        *metav1.Duration `json:"tokenTTL,omitempty"`
+	TokenMaxTTL     *metav1.Duration `json:"tokenMaxTTL,omitempty"`
+}
+
+// PolicyRule grants capabilities on a path relative to the namespace secrets path.
+type PolicyRule struct {
+	Path         string   `json:"path"`
+	Capabilities []string `json:"capabilities"`
+}
+
+type VaultBindingSpec struct {
+	ServiceAccounts      []ServiceAccount `json:"serviceAccounts,omitempty"`
+	Groups               []string         `json:"groups,omitempty"`
+	PolicyRules          []PolicyRule     `json:"policyRules,omitempty"`
+	PolicyTier           string           `json:"policyTier,omitempty"`
+	KVVersion            int              `json:"kvVersion,omitempty"`
+	KVMaxVersions        int              `json:"kvMaxVersions,omitempty"`
+	KVCASRequired        bool             `json:"kvCasRequired,omitempty"`
+	KVDeleteVersionAfter *metav1.Duration `json:"kvDeleteVersionAfter,omitempty"`
+	TokenTTL             *metav1.Duration `json:"tokenTTL,omitempty"`
+	// VaultTargets are names of vault targets, -defaultVaultTargets if empty.
+	VaultTargets []string `json:"vaultTargets,omitempty"`
+}
+
+type Condition struct {
+	Type               string                 `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+}
+
+type Conditions []Condition
+
+// Status is the reconcile outcome shared by VaultBinding and the vault-link/status namespace annotation.
+type Status struct {
+	Conditions         Conditions   `json:"conditions,omitempty"`
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	LastReconcileTime  *metav1.Time `json:"lastReconcileTime,omitempty"`
+	LastError          string       `json:"lastError,omitempty"`
+}
+
+type VaultBindingStatus struct {
+	Status      `json:",inline"`
+	AuthPath    string `json:"authPath,omitempty"`
+	PolicyName  string `json:"policyName,omitempty"`
+	SecretsPath string `json:"secretsPath,omitempty"`
+	// VaultNamespace is the vault enterprise namespace of the binding.
+	VaultNamespace string `json:"vaultNamespace,omitempty"`
+	// Groups are bound groups as group:tier.
+	Groups []string `json:"groups,omitempty"`
+	// VaultTargets are names of bound vault targets.
+	VaultTargets []string `json:"vaultTargets,omitempty"`
+}
+
+func FromUnstructured(u *unstructured.Unstructured) (*VaultBinding, error) {
+	vb := new(VaultBinding)
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), vb)
+	return vb, err
+}
+
+func (vb *VaultBinding) ToUnstructured() (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(vb)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// Set adds or replaces condition of the same type, transition time changes only with status.
+func (cs *Conditions) Set(c Condition) {
+	for i, current := range *cs {
+		if current.Type != c.Type {
+			continue
+		}
+		if current.Status == c.Status {
+			c.LastTransitionTime = current.LastTransitionTime
+		}
+		(*cs)[i] = c
+		return
+	}
+	*cs = append(*cs, c)
+}
+
+// Copy returns status with its own conditions slice.
+func (s Status) Copy() Status {
+	s.Conditions = append(Conditions(nil), s.Conditions...)
+	return s
+}
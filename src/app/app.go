@@ -2,7 +2,7 @@ package app
 
 import (
 	"os"
-	"time"
+	"sync"
 
 	"vaultlink/args"
 	"vaultlink/server"
@@ -11,18 +11,33 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/informers"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 type App struct {
-	vault     *vault.Vault
-	args      *args.Args
-	clientset *kubernetes.Clientset
-	server    *server.Server
-	cache     map[string]bool
+	vault         *vault.Vault
+	vaults        map[string]*vault.Vault
+	policies      *vault.PolicyTemplates
+	args          *args.Args
+	config        *rest.Config
+	clientset     *kubernetes.Clientset
+	dynamic       dynamic.Interface
+	recorder      record.EventRecorder
+	server        *server.Server
+	queue         workqueue.RateLimitingInterface
+	nsLister      corelisters.NamespaceLister
+	bindingQueue  workqueue.RateLimitingInterface
+	bindingLister cache.GenericLister
+	deleted       map[string]*corev1.Namespace
+	deletedMu     sync.Mutex
+	tokens        map[string]reviewerToken
+	tokensMu      sync.Mutex
 }
 
 type AppInterface interface {
@@ -34,11 +49,19 @@ type AppInterface interface {
 func New() *App {
 	a := new(App)
 	a.args = args.New().LogLevel()
-	a.cache = make(map[string]bool)
-	a.vault = vault.New(a.Args().VaultAddr, a.Args().VaultPolicyT, a.Args().VaultSecretsPathT, a.Args().VaultAuthT).Connect()
-	a.server = server.New(a.vault, a.Args().Port)
-	go a.server.Listen()
-	a.SetToken()
+	a.deleted = make(map[string]*corev1.Namespace)
+	a.tokens = make(map[string]reviewerToken)
+	targets, err := a.args.Targets()
+	if err != nil {
+		log.Errorf("Vault targets error:%s", err)
+		os.Exit(1)
+	}
+	a.vaults = make(map[string]*vault.Vault)
+	for name, targetArgs := range targets {
+		a.vaults[name] = newVault(name, targetArgs)
+	}
+	a.vault = a.vaults[args.DefaultTarget]
+	a.server = server.New(a.vaults, a.Args().Port)
 	return a
 }
 
@@ -46,6 +69,7 @@ func (a *App) ClientSet() *kubernetes.Clientset {
 	return a.clientset
 }
 
+// Vault returns the default vault target.
 func (a *App) Vault() *vault.Vault {
 	return a.vault
 }
@@ -54,66 +78,29 @@ func (a *App) Args() *args.Args {
 	return a.args
 }
 
-func (a *App) SetToken() *App {
-	var token string
-	if len(a.args.AuthPath) > 0 {
-		token = a.vault.KubeAuth(a.args.KubeTokenPath, a.args.AuthPath)
-	} else {
-		token = a.args.VaultToken
-	}
-	a.vault.SetToken(a.args.Unwrap, token)
-	return a
-}
-
 func (a *App) Connect() *App {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		log.Errorf("In-cluster config error:%s", err)
 		os.Exit(1)
 	}
+	a.config = config
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		log.Errorf("Clientset error:%s", err)
 		os.Exit(1)
 	}
 	a.clientset = clientset
-	return a
-}
-
-func (a *App) Control() {
-	informerFactory := informers.NewSharedInformerFactory(a.ClientSet(), time.Second*30)
-
-	informerFactory.Core().V1().Namespaces().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(ns interface{}) {
-			if Ns, ok := ns.(*corev1.Namespace); ok {
-				log.Debugf("Event: create %s", Ns.Name)
-				a.onCreateNamespace(Ns)
-			}
-		},
-		DeleteFunc: func(ns interface{}) {
-			if Ns, ok := ns.(*corev1.Namespace); ok {
-				log.Debugf("Event: delete %s", Ns.Name)
-				a.unbindVault(Ns)
-			}
-		},
-		UpdateFunc: func(old, new interface{}) {
-			if newNs, ok := new.(*corev1.Namespace); ok {
-				if oldNs, ok := old.(*corev1.Namespace); ok {
-					if newNs.GetResourceVersion() != oldNs.GetResourceVersion() {
-						log.Debugf("Event: update %s, phase:%s", newNs.Name, newNs.Status.Phase)
-						if newNs.Status.Phase == "Active" {
-							a.onUpdateNamespace(oldNs, newNs)
-						}
-					}
-				}
-			}
-		},
-	})
-
-	stop := make(chan struct{})
-	defer close(stop)
-	informerFactory.Start(stop)
-	for {
-		time.Sleep(time.Second)
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Errorf("Dynamic client error:%s", err)
+		os.Exit(1)
+	}
+	a.dynamic = dynamicClient
+	a.recorder = a.newRecorder()
+	if err := a.loadPolicyTemplates(); err != nil {
+		log.Errorf("Policy templates error:%s", err)
+		os.Exit(1)
 	}
+	return a
 }
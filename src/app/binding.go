@@ -0,0 +1,250 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"vaultlink/apis/v1alpha1"
+	"vaultlink/vault"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+func (a *App) watchBindings(stop <-chan struct{}) bool {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(a.dynamic, time.Second*30)
+	informer := factory.ForResource(v1alpha1.VaultBindingResource)
+	a.bindingLister = informer.Lister()
+
+	enqueue := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			log.Errorf("VaultBinding key error:%s", err)
+			return
+		}
+		log.Debugf("Event: VaultBinding %s", key)
+		a.bindingQueue.Add(key)
+	}
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		DeleteFunc: enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			enqueue(new)
+		},
+	})
+
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, informer.Informer().HasSynced) {
+		log.Errorf("Failed to sync VaultBinding cache")
+		return false
+	}
+	return true
+}
+
+func (a *App) listBindings(namespace string) []*v1alpha1.VaultBinding {
+	if a.bindingLister == nil {
+		return nil
+	}
+	objs, err := a.bindingLister.ByNamespace(namespace).List(labels.Everything())
+	if err != nil {
+		log.Errorf("List VaultBindings namespace:%s error:%s", namespace, err)
+		return nil
+	}
+	var re []*v1alpha1.VaultBinding
+	for _, obj := range objs {
+		vb, err := v1alpha1.FromUnstructured(obj.(*unstructured.Unstructured))
+		if err != nil {
+			log.Errorf("Convert VaultBinding namespace:%s error:%s", namespace, err)
+			continue
+		}
+		re = append(re, vb)
+	}
+	return re
+}
+
+func (a *App) hasBinding(namespace string) bool {
+	return len(a.listBindings(namespace)) > 0
+}
+
+// activeBinding returns name of the oldest VaultBinding in the namespace, the only one that is bound.
+func (a *App) activeBinding(namespace string) string {
+	bindings := a.listBindings(namespace)
+	if len(bindings) == 0 {
+		return ""
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		ti, tj := bindings[i].CreationTimestamp, bindings[j].CreationTimestamp
+		if ti.Equal(&tj) {
+			return bindings[i].Name < bindings[j].Name
+		}
+		return ti.Before(&tj)
+	})
+	return bindings[0].Name
+}
+
+func (a *App) getBinding(key string) (*v1alpha1.VaultBinding, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := a.bindingLister.ByNamespace(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return v1alpha1.FromUnstructured(obj.(*unstructured.Unstructured))
+}
+
+func (a *App) bindingSpec(vb *v1alpha1.VaultBinding) (*vault.BindSpec, error) {
+	spec := a.newSpec(vb.Namespace)
+	spec.Targets = a.specTargets(strings.Join(vb.Spec.VaultTargets, ","))
+	spec.BoundTargets = boundTargets(strings.Join(vb.Status.VaultTargets, ","), len(vb.Status.AuthPath) > 0)
+	roles, err := a.roles(vb.Spec.ServiceAccounts)
+	if err != nil {
+		return spec, err
+	}
+	spec.Roles = roles
+	if spec.Groups, err = vault.ParseGroups(strings.Join(vb.Spec.Groups, ",")); err != nil {
+		return spec, &reasonError{"InvalidSpec", err}
+	}
+	spec.BoundGroups, _ = vault.ParseGroups(strings.Join(vb.Status.Groups, ","))
+	for _, rule := range vb.Spec.PolicyRules {
+		spec.Rules = append(spec.Rules, vault.PolicyRule{Path: rule.Path, Capabilities: rule.Capabilities})
+	}
+	if len(vb.Spec.PolicyTier) > 0 {
+		spec.PolicyTier = vb.Spec.PolicyTier
+	}
+	if err := a.checkTiers(vb.Spec.PolicyTier, spec.Groups); err != nil {
+		return spec, &reasonError{"InvalidSpec", err}
+	}
+	if ns, err := a.nsLister.Get(vb.Namespace); err == nil {
+		spec.Labels = ns.GetLabels()
+	}
+	if vb.Spec.KVVersion != 0 {
+		spec.KVVersion = vb.Spec.KVVersion
+	}
+	spec.KVMaxVersions = vb.Spec.KVMaxVersions
+	spec.KVCASRequired = vb.Spec.KVCASRequired
+	if vb.Spec.KVDeleteVersionAfter != nil {
+		spec.KVDeleteVersionAfter = vb.Spec.KVDeleteVersionAfter.Duration
+	}
+	if vb.Spec.TokenTTL != nil {
+		spec.TokenTTL = vb.Spec.TokenTTL.Duration
+	}
+	return spec, a.checkLimits(spec)
+}
+
+func (a *App) updateBinding(vb *v1alpha1.VaultBinding) (*v1alpha1.VaultBinding, error) {
+	u, err := vb.ToUnstructured()
+	if err != nil {
+		return nil, err
+	}
+	u, err = a.dynamic.Resource(v1alpha1.VaultBindingResource).Namespace(vb.Namespace).Update(u, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return v1alpha1.FromUnstructured(u)
+}
+
+func (a *App) updateBindingStatus(vb *v1alpha1.VaultBinding, status v1alpha1.VaultBindingStatus) error {
+	if !statusChanged(vb.Status.Status, status.Status) && reflect.DeepEqual(
+		[]string{vb.Status.AuthPath, vb.Status.PolicyName, vb.Status.SecretsPath, vb.Status.VaultNamespace, strings.Join(vb.Status.Groups, ","), strings.Join(vb.Status.VaultTargets, ",")},
+		[]string{status.AuthPath, status.PolicyName, status.SecretsPath, status.VaultNamespace, strings.Join(status.Groups, ","), strings.Join(status.VaultTargets, ",")}) {
+		return nil
+	}
+	vb.Status = status
+	u, err := vb.ToUnstructured()
+	if err != nil {
+		return err
+	}
+	_, err = a.dynamic.Resource(v1alpha1.VaultBindingResource).Namespace(vb.Namespace).UpdateStatus(u, metav1.UpdateOptions{})
+	return err
+}
+
+// reconcileBinding binds VaultBinding namespace with the same vault logic as namespace annotations.
+func (a *App) reconcileBinding(key string) error {
+	vb, err := a.getBinding(key)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if vb.GetDeletionTimestamp() != nil {
+		return a.cleanupBinding(vb)
+	}
+
+	if active := a.activeBinding(vb.Namespace); active != vb.Name {
+		err := &reasonError{"Conflict", fmt.Errorf("namespace is bound by VaultBinding:%s", active)}
+		a.bindingWarning(vb, err)
+		status := vb.Status
+		status.Status = reconciledStatus(vb.Status.Status, vb.GetGeneration(), false, err)
+		return a.updateBindingStatus(vb, status)
+	}
+
+	if !hasFinalizer(vb) {
+		vb.SetFinalizers(append(vb.GetFinalizers(), finalizer))
+		if vb, err = a.updateBinding(vb); err != nil {
+			return err
+		}
+	}
+
+	spec, bindErr := a.bindingSpec(vb)
+	var info *vault.BindInfo
+	if bindErr == nil {
+		info, bindErr = a.bind(spec)
+	}
+	status := vb.Status
+	status.Status = reconciledStatus(vb.Status.Status, vb.GetGeneration(), len(vb.Status.AuthPath) > 0, bindErr)
+	if bindErr != nil {
+		a.bindingWarning(vb, bindErr)
+	} else if len(vb.Status.AuthPath) == 0 {
+		a.bindingEventf(vb, corev1.EventTypeNormal, "Bound", "Bound to vault auth:%s policy:%s secrets:%s", info.Auth, info.Policy, info.Policypath)
+	}
+	if bindErr == nil {
+		status.AuthPath = info.Auth
+		status.PolicyName = info.Policy
+		status.SecretsPath = info.Policypath
+		status.VaultNamespace = info.Namespace
+		status.VaultTargets = info.Targets
+		status.Groups = nil
+		for _, group := range info.Groups {
+			status.Groups = append(status.Groups, group.String())
+		}
+	}
+	if err := a.updateBindingStatus(vb, status); err != nil {
+		log.Errorf("Update VaultBinding:%s status error:%s", key, err)
+	}
+	return bindErr
+}
+
+func (a *App) cleanupBinding(vb *v1alpha1.VaultBinding) error {
+	if !hasFinalizer(vb) {
+		return nil
+	}
+	log.Infof("Cleanup deleted VaultBinding:%s/%s", vb.Namespace, vb.Name)
+	spec, err := a.bindingSpec(vb)
+	if err != nil {
+		log.Warnf("Unbind VaultBinding:%s/%s with invalid spec, error:%s", vb.Namespace, vb.Name, err)
+	}
+	if err := a.unbind(spec); err != nil {
+		a.bindingWarning(vb, err)
+		if !a.forceCleanup(vb) {
+			return err
+		}
+		log.Warnf("Forced cleanup of VaultBinding:%s/%s, vault resources may be left behind, error:%s", vb.Namespace, vb.Name, err)
+	} else {
+		a.bindingEventf(vb, corev1.EventTypeNormal, "Unbound", "Removed vault binding")
+	}
+	vb.SetFinalizers(withoutFinalizer(vb))
+	_, err = a.updateBinding(vb)
+	return err
+}
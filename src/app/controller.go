@@ -0,0 +1,166 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func (a *App) enqueue(ns *corev1.Namespace) {
+	a.queue.Add(ns.GetName())
+}
+
+func (a *App) onDeleteNamespace(obj interface{}) {
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			log.Errorf("Unexpected object on delete:%v", obj)
+			return
+		}
+		if ns, ok = tombstone.Obj.(*corev1.Namespace); !ok {
+			log.Errorf("Unexpected tombstone object on delete:%v", tombstone.Obj)
+			return
+		}
+	}
+	log.Debugf("Event: delete %s", ns.Name)
+	a.deletedMu.Lock()
+	a.deleted[ns.Name] = ns
+	a.deletedMu.Unlock()
+	a.enqueue(ns)
+}
+
+// deletedNamespace returns the last known state of a deleted namespace, if any.
+func (a *App) deletedNamespace(namespace string) *corev1.Namespace {
+	a.deletedMu.Lock()
+	defer a.deletedMu.Unlock()
+	return a.deleted[namespace]
+}
+
+func (a *App) forgetDeleted(namespace string) {
+	a.deletedMu.Lock()
+	defer a.deletedMu.Unlock()
+	delete(a.deleted, namespace)
+}
+
+// Control reconciles namespaces until the process exits, with leader election only the leader does.
+func (a *App) Control() {
+	if a.Args().LeaderElect {
+		a.runLeaderElection()
+		return
+	}
+	go a.server.Listen()
+	a.control(make(chan struct{}))
+}
+
+// control runs informers and workers until stop is closed, it returns after running reconciles finish.
+func (a *App) control(stop <-chan struct{}) {
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	a.queue = a.newQueue("namespaces")
+	defer a.queue.ShutDown()
+
+	informerFactory := informers.NewSharedInformerFactory(a.ClientSet(), time.Second*30)
+	nsInformer := informerFactory.Core().V1().Namespaces()
+	a.nsLister = nsInformer.Lister()
+
+	nsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(ns interface{}) {
+			if Ns, ok := ns.(*corev1.Namespace); ok {
+				log.Debugf("Event: create %s", Ns.Name)
+				a.enqueue(Ns)
+			}
+		},
+		DeleteFunc: a.onDeleteNamespace,
+		UpdateFunc: func(old, new interface{}) {
+			if newNs, ok := new.(*corev1.Namespace); ok {
+				if oldNs, ok := old.(*corev1.Namespace); ok {
+					if newNs.GetResourceVersion() == oldNs.GetResourceVersion() {
+						log.Debugf("Event: resync %s", newNs.Name)
+					} else {
+						log.Debugf("Event: update %s, phase:%s", newNs.Name, newNs.Status.Phase)
+					}
+					a.enqueue(newNs)
+				}
+			}
+		},
+	})
+
+	informerFactory.Start(stop)
+	if !cache.WaitForCacheSync(stop, nsInformer.Informer().HasSynced) {
+		log.Errorf("Failed to sync namespace cache")
+		return
+	}
+
+	if a.Args().VaultBindings {
+		a.bindingQueue = a.newQueue("vaultbindings")
+		defer a.bindingQueue.ShutDown()
+		if !a.watchBindings(stop) {
+			return
+		}
+		a.startWorkers("vaultbinding", a.bindingQueue, a.reconcileBinding, stop, &workers)
+	}
+
+	if a.Args().GCInterval > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			wait.Until(a.collectGarbage, a.Args().GCInterval, stop)
+		}()
+	}
+
+	a.startWorkers("namespace", a.queue, a.reconcile, stop, &workers)
+	<-stop
+	log.Infof("Stopping reconcile workers")
+}
+
+func (a *App) newQueue(name string) workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(
+		workqueue.NewItemExponentialFailureRateLimiter(a.Args().RetryBaseDelay, a.Args().RetryMaxDelay),
+		name,
+	)
+}
+
+// startWorkers runs reconcile workers until stop is closed and the queue is shut down.
+func (a *App) startWorkers(kind string, queue workqueue.RateLimitingInterface, reconcile func(string) error, stop <-chan struct{}, workers *sync.WaitGroup) {
+	log.Infof("Starting %d %s reconcile workers", a.Args().Workers, kind)
+	for i := 0; i < a.Args().Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			wait.Until(func() {
+				for processNextItem(kind, queue, reconcile, stop) {
+				}
+			}, time.Second, stop)
+		}()
+	}
+}
+
+// processNextItem reconciles the next queued item, items left in the queue after stop are not reconciled.
+func processNextItem(kind string, queue workqueue.RateLimitingInterface, reconcile func(string) error, stop <-chan struct{}) bool {
+	key, quit := queue.Get()
+	if quit {
+		return false
+	}
+	defer queue.Done(key)
+	select {
+	case <-stop:
+		return false
+	default:
+	}
+	name := key.(string)
+	if err := reconcile(name); err != nil {
+		log.Errorf("Reconcile %s:%s, retry:%d, error:%s", kind, name, queue.NumRequeues(key), err)
+		queue.AddRateLimited(key)
+		return true
+	}
+	queue.Forget(key)
+	return true
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"vaultlink/apis/v1alpha1"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func (a *App) newRecorder() record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: a.ClientSet().CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "vaultlink"})
+}
+
+// nsRef refers to the namespace by name, uid is taken from the cache so that kubectl describe finds the events.
+func (a *App) nsRef(namespace string) *corev1.ObjectReference {
+	ref := &corev1.ObjectReference{Kind: "Namespace", APIVersion: "v1", Name: namespace}
+	if a.nsLister != nil {
+		if ns, err := a.nsLister.Get(namespace); err == nil {
+			ref.UID = ns.GetUID()
+		}
+	}
+	return ref
+}
+
+func (a *App) nsEventf(namespace, eventType, reason, format string, args ...interface{}) {
+	a.recorder.Eventf(a.nsRef(namespace), eventType, reason, format, args...)
+}
+
+func (a *App) nsWarning(namespace string, err error) {
+	a.nsEventf(namespace, corev1.EventTypeWarning, failureReason(err), "%s", err)
+}
+
+func (a *App) bindingEventf(vb *v1alpha1.VaultBinding, eventType, reason, format string, args ...interface{}) {
+	u, err := vb.ToUnstructured()
+	if err != nil {
+		log.Errorf("VaultBinding:%s/%s event error:%s", vb.Namespace, vb.Name, err)
+		return
+	}
+	a.recorder.Eventf(u, eventType, reason, format, args...)
+}
+
+func (a *App) bindingWarning(vb *v1alpha1.VaultBinding, err error) {
+	a.bindingEventf(vb, corev1.EventTypeWarning, failureReason(err), "%s", err)
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// finalizer keeps a bound namespace around until its vault resources are removed.
+const finalizer = "vault-link/cleanup"
+
+func hasFinalizer(obj metav1.Object) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutFinalizer(obj metav1.Object) []string {
+	var re []string
+	for _, f := range obj.GetFinalizers() {
+		if f != finalizer {
+			re = append(re, f)
+		}
+	}
+	return re
+}
+
+// forceCleanup tells if finalizer is to be removed even though vault cleanup failed,
+// either on explicit vault-link/force-cleanup annotation or after cleanup timeout.
+func (a *App) forceCleanup(obj metav1.Object) bool {
+	if ensureMap(obj.GetAnnotations())["vault-link/force-cleanup"] == "true" {
+		return true
+	}
+	timeout := a.Args().CleanupTimeout
+	return timeout > 0 && time.Since(obj.GetDeletionTimestamp().Time) > timeout
+}
+
+// cleanup unbinds a namespace marked for deletion and releases its finalizer.
+func (a *App) cleanup(ns *corev1.Namespace) error {
+	if !hasFinalizer(ns) {
+		return nil
+	}
+	log.Infof("Cleanup deleted namespace:%s", ns.GetName())
+	if err := a.unbindVault(ns); err != nil {
+		if !a.forceCleanup(ns) {
+			return err
+		}
+		log.Warnf("Forced cleanup of namespace:%s, vault resources may be left behind, error:%s", ns.GetName(), err)
+	}
+	return a.removeFinalizer(ns)
+}
+
+func (a *App) removeFinalizer(ns *corev1.Namespace) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		nsTmp, err := a.ClientSet().CoreV1().Namespaces().Get(ns.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !hasFinalizer(nsTmp) {
+			return nil
+		}
+		nsTmp.SetFinalizers(withoutFinalizer(nsTmp))
+		_, err = a.ClientSet().CoreV1().Namespaces().Update(nsTmp)
+		return err
+	})
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"vaultlink/vault"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+func (a *App) namespaceAlive(namespace string) bool {
+	_, err := a.nsLister.Get(namespace)
+	return err == nil || !errors.IsNotFound(err)
+}
+
+// collectGarbage removes vault resources owned by this cluster whose namespace no longer exists.
+func (a *App) collectGarbage() {
+	for name, v := range a.vaults {
+		if err := v.Available(); err != nil {
+			log.Warnf("Skip garbage collection of unavailable vault target:%s, error:%s", name, err)
+			continue
+		}
+		a.collectTargetGarbage(name, v)
+	}
+}
+
+func (a *App) collectTargetGarbage(target string, v *vault.Vault) {
+	orphans, err := v.Orphans(a.Args().Cluster, a.Args().ServiceAccount, a.namespaceAlive)
+	if err != nil {
+		log.Errorf("Garbage collection of vault target:%s, error:%s", target, err)
+		return
+	}
+	log.Infof("Garbage collection found %d orphans in vault target:%s", len(orphans), target)
+	for _, orphan := range orphans {
+		if a.Args().GCReportOnly {
+			log.Warnf("Orphan %s in vault target:%s", orphan, target)
+			continue
+		}
+		log.Infof("Deleting orphan %s in vault target:%s", orphan, target)
+		if err := v.DeleteOrphan(orphan); err != nil {
+			log.Errorf("Delete orphan %s in vault target:%s, error:%s", orphan, target, err)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package app
 
 import (
 	"fmt"
+	"strings"
 
 	"vaultlink/vault"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/util/retry"
 )
@@ -26,54 +28,147 @@ func ignoreErr(b []byte, err error) []byte {
 	return b
 }
 
-func getOktaGroup(ns *corev1.Namespace) string {
-	ann := ns.GetAnnotations()
-	if ann == nil {
-		return ""
+// getGroups returns groups of vault-link/groups annotation, e.g. "dev: read-only, sre: admin",
+// and the group of vault-link/group annotation with the namespace policy tier.
+func getGroups(ns *corev1.Namespace) ([]vault.Group, error) {
+	ann := ensureMap(ns.GetAnnotations())
+	groups, err := vault.ParseGroups(ann["vault-link/groups"])
+	if err != nil {
+		return nil, invalidAnnotation("vault-link/groups", err)
 	}
-	if group, ok := ann["vault-link/group"]; ok {
-		return group
+	if group := ann["vault-link/group"]; len(group) > 0 {
+		for _, g := range groups {
+			if g.Name == group {
+				return groups, nil
+			}
+		}
+		groups = append(groups, vault.Group{Name: group})
 	}
-	return ""
+	return groups, nil
 }
 
-func (a *App) bindVault(ns *corev1.Namespace) error {
-	namespace := ns.GetName()
-	saName := a.Args().ServiceAccount
-	sa, err := a.ClientSet().CoreV1().ServiceAccounts(namespace).Get(saName, metav1.GetOptions{})
+func (a *App) newSpec(namespace string) *vault.BindSpec {
+	return &vault.BindSpec{
+		Cluster:        a.Args().Cluster,
+		Namespace:      namespace,
+		ServiceAccount: a.Args().ServiceAccount,
+		KubeAddr:       a.Args().KubeAddr,
+		PolicyTier:     a.Args().PolicyTier,
+		KVDefault:      a.Args().KVVersion,
+		ClientReviewer: a.Args().ReviewerMode == reviewerClient,
+	}
+}
+
+func (a *App) nsSpec(ns *corev1.Namespace) (*vault.BindSpec, error) {
+	spec := a.newSpec(ns.GetName())
+	spec.Labels = ns.GetLabels()
+	if tier, ok := ensureMap(ns.GetAnnotations())["vault-link/policy-tier"]; ok {
+		spec.PolicyTier = tier
+	}
+	spec.BoundGroups, _ = vault.ParseGroups(ensureMap(ns.GetAnnotations())["vault-link/vault.groups"])
+	spec.Targets = a.specTargets(ensureMap(ns.GetAnnotations())["vault-link/vault-targets"])
+	spec.BoundTargets = boundTargets(ensureMap(ns.GetAnnotations())["vault-link/vault.targets"], isBound(ns))
+	groups, err := getGroups(ns)
+	if err != nil {
+		return spec, err
+	}
+	spec.Groups = groups
+	if err := a.checkTiers(ensureMap(ns.GetAnnotations())["vault-link/policy-tier"], nil); err != nil {
+		return spec, invalidAnnotation("vault-link/policy-tier", err)
+	}
+	if err := a.checkTiers("", groups); err != nil {
+		return spec, invalidAnnotation("vault-link/groups", err)
+	}
+	if value, ok := ensureMap(ns.GetAnnotations())["vault-link/service-accounts"]; ok {
+		sas, err := parseServiceAccounts(value)
+		if err != nil {
+			return spec, err
+		}
+		if spec.Roles, err = a.roles(sas); err != nil {
+			return spec, err
+		}
+	}
+	if err := tokenOverrides(ns, spec); err != nil {
+		return spec, err
+	}
+	if err := kvOverrides(ns, spec); err != nil {
+		return spec, err
+	}
+	return spec, a.checkLimits(spec)
+}
+
+// bind configures vault and the token review role for spec, it is shared by namespace annotations and VaultBinding.
+func (a *App) bind(spec *vault.BindSpec) (*vault.BindInfo, error) {
+	fresh, err := a.setReviewer(spec)
 	if err != nil {
-		log.Errorf("Get service account:%s namespace:%s %s", saName, namespace, err)
+		return nil, err
+	}
+	info, err := a.bindTargets(spec)
+	if err != nil {
+		return nil, err
+	}
+	if fresh != nil {
+		a.storeToken(spec.Namespace, spec.ServiceAccount, fresh)
+	}
+	for _, sa := range reviewers(spec) {
+		if err := a.createReviewRole(spec.Namespace, sa); err != nil {
+			return nil, err
+		}
+	}
+	// review roles of removed service accounts, like vault roles pruned by bind
+	if err := a.pruneReviewRoles(spec.Namespace, reviewers(spec)); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (a *App) unbind(spec *vault.BindSpec) error {
+	if err := a.unbindTargets(spec); err != nil {
 		return err
 	}
-	secret, err := a.ClientSet().CoreV1().Secrets(namespace).Get(sa.Secrets[0].Name, metav1.GetOptions{})
+	a.forgetToken(spec.Namespace, spec.ServiceAccount)
+	// review roles created before they were labeled are only found by name
+	for _, sa := range reviewers(spec) {
+		if err := a.deleteReviewRole(spec.Namespace, sa); err != nil {
+			return err
+		}
+	}
+	return a.pruneReviewRoles(spec.Namespace, nil)
+}
+
+func (a *App) bindVault(ns *corev1.Namespace) error {
+	spec, err := a.nsSpec(ns)
 	if err != nil {
-		log.Errorf("Get secret:%s namespace:%s %s", sa.Secrets[0].Name, namespace, err)
 		return err
 	}
-	group := getOktaGroup(ns)
-	if len(group) > 0 {
-		info := a.Vault().Bind(a.Args().Cluster, namespace, saName, a.Args().KubeAddr, group, secret.Data["token"], secret.Data["ca.crt"])
-		a.createReviewRole(namespace, saName)
-		a.setNs(ns, info)
-	} else {
+	if len(spec.Groups) == 0 {
 		log.Warnf("No group annotation for namespace:%s", ns.Name)
+		return &reasonError{"MissingGroup", fmt.Errorf("no vault-link/group or vault-link/groups annotation")}
 	}
-	return nil
+	info, err := a.bind(spec)
+	if err != nil {
+		return err
+	}
+	return a.setNs(ns, info)
 }
 
-func (a *App) unbindVault(ns *corev1.Namespace) {
-	namespace := ns.GetName()
-	saName := a.Args().ServiceAccount
-	group := getOktaGroup(ns)
-	a.Vault().Unbind(a.Args().Cluster, namespace, saName, group)
-	a.deleteReviewRole(namespace, saName)
-	a.deleteClusterRoleBinding(namespace, saName)
+func (a *App) unbindVault(ns *corev1.Namespace) error {
+	spec, err := a.nsSpec(ns)
+	if err != nil {
+		log.Warnf("Unbind namespace:%s with invalid annotations, error:%s", ns.GetName(), err)
+	}
+	if err := a.unbind(spec); err != nil {
+		a.nsWarning(ns.GetName(), err)
+		return err
+	}
+	a.nsEventf(ns.GetName(), corev1.EventTypeNormal, "Unbound", "Removed vault binding")
 	a.unsetNs(ns)
+	return nil
 }
 
-func (a *App) setNs(ns *corev1.Namespace, info *vault.BindInfo) {
+func (a *App) setNs(ns *corev1.Namespace, info *vault.BindInfo) error {
 	if ns.Status.Phase != "Active" {
-		return
+		return nil
 	}
 	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		nsTmp, err := a.ClientSet().CoreV1().Namespaces().Get(ns.Name, metav1.GetOptions{})
@@ -81,18 +176,51 @@ func (a *App) setNs(ns *corev1.Namespace, info *vault.BindInfo) {
 			return err
 		}
 		ann := ensureMap(nsTmp.GetAnnotations())
-		ann["vault-link/bind"] = "true"
-		ann["vault-link/vault"] = a.Vault().Addr()
-		ann["vault-link/vault.auth"] = info.Auth
-		ann["vault-link/vault.policy"] = info.Policy
-		ann["vault-link/vault.policy-path"] = info.Policypath
+		want := map[string]string{
+			"vault-link/bind":              "true",
+			"vault-link/vault":             a.targetAddr(info),
+			"vault-link/vault.auth":        info.Auth,
+			"vault-link/vault.policy":      info.Policy,
+			"vault-link/vault.policy-path": info.Policypath,
+			"vault-link/vault.groups":      vault.FormatGroups(info.Groups),
+			"vault-link/vault.namespace":   info.Namespace,
+			"vault-link/vault.targets":     strings.Join(info.Targets, ","),
+		}
+		changed := false
+		for key, value := range want {
+			current, ok := ann[key]
+			switch {
+			case len(value) == 0 && ok:
+				delete(ann, key)
+				changed = true
+			case len(value) > 0 && current != value:
+				ann[key] = value
+				changed = true
+			}
+		}
+		// vault-link/error is replaced by vault-link/status
+		if _, ok := ann["vault-link/error"]; ok {
+			delete(ann, "vault-link/error")
+			changed = true
+		}
+		if !hasFinalizer(nsTmp) {
+			nsTmp.SetFinalizers(append(nsTmp.GetFinalizers(), finalizer))
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
 		nsTmp.SetAnnotations(ann)
 		_, err = a.ClientSet().CoreV1().Namespaces().Update(nsTmp)
+		if err == nil {
+			a.nsEventf(ns.GetName(), corev1.EventTypeNormal, "Bound", "Bound to vault auth:%s policy:%s secrets:%s", info.Auth, info.Policy, info.Policypath)
+		}
 		return err
 	})
 	if retryErr != nil {
 		log.Errorf("Updating namespace:%s, error:%s", ns.GetName(), retryErr)
 	}
+	return retryErr
 }
 
 func (a *App) unsetNs(ns *corev1.Namespace) {
@@ -110,7 +238,13 @@ func (a *App) unsetNs(ns *corev1.Namespace) {
 		delete(ann, "vault-link/vault.auth")
 		delete(ann, "vault-link/vault.policy")
 		delete(ann, "vault-link/vault.policy-path")
+		delete(ann, "vault-link/vault.groups")
+		delete(ann, "vault-link/vault.namespace")
+		delete(ann, "vault-link/vault.targets")
+		delete(ann, "vault-link/status")
+		delete(ann, "vault-link/error")
 		nsTmp.SetAnnotations(ann)
+		nsTmp.SetFinalizers(withoutFinalizer(nsTmp))
 		_, err = a.ClientSet().CoreV1().Namespaces().Update(nsTmp)
 		return err
 	})
@@ -119,41 +253,86 @@ func (a *App) unsetNs(ns *corev1.Namespace) {
 	}
 }
 
-func (a *App) deleteClusterRoleBinding(namespace, saName string) error {
-	name := fmt.Sprintf("%s-%s-tokenreview-binding", namespace, saName)
-	return a.ClientSet().RbacV1().ClusterRoleBindings().Delete(name, &metav1.DeleteOptions{})
+func isBound(ns *corev1.Namespace) bool {
+	return len(ensureMap(ns.GetAnnotations())["vault-link/vault.auth"]) > 0
 }
 
-func (a *App) onCreateNamespace(ns *corev1.Namespace) {
-	a.cache[ns.Name] = true
+func wantBound(ns *corev1.Namespace) bool {
+	return ensureMap(ns.GetAnnotations())["vault-link/bind"] == "true"
 }
 
-func (a *App) onUpdateNamespace(old, new *corev1.Namespace) {
-	namespace := new.GetName()
-	newAnn := ensureMap(new.GetAnnotations())
-	oldAnn := ensureMap(old.GetAnnotations())
-	if newAnn["vault-link/bind"] == "true" && oldAnn["vault-link/bind"] != "true" {
+// reconcile brings vault state in line with the namespace annotations,
+// it only looks at the current namespace state, not at the event that triggered it.
+// Bound namespaces are re-bound on every resync to repair drift in vault.
+func (a *App) reconcile(namespace string) error {
+	ns, err := a.nsLister.Get(namespace)
+	if errors.IsNotFound(err) {
+		deleted := a.deletedNamespace(namespace)
+		if deleted != nil && !hasFinalizer(deleted) && (wantBound(deleted) || isBound(deleted)) {
+			log.Debugf("Unbind deleted namespace:%s", namespace)
+			if err := a.unbindVault(deleted); err != nil {
+				return err
+			}
+		}
+		a.forgetDeleted(namespace)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ns.GetDeletionTimestamp() != nil {
+		return a.cleanup(ns)
+	}
+	if ns.Status.Phase != corev1.NamespaceActive {
+		return nil
+	}
+	if a.hasBinding(namespace) {
+		log.Debugf("Namespace:%s is bound by VaultBinding, skip annotations", namespace)
+		return nil
+	}
+	switch {
+	case wantBound(ns):
 		log.Debugf("Bind namespace:%s", namespace)
-		a.bindVault(new)
-	} else if newAnn["vault-link/bind"] == "true" && a.cache[new.Name] {
-		if a.bindVault(new) == nil {
-			delete(a.cache, new.Name)
+		err := a.bindVault(ns)
+		if err != nil {
+			a.nsWarning(namespace, err)
 		}
-	} else if newAnn["vault-link/bind"] != "true" && oldAnn["vault-link/bind"] == "true" {
+		a.setNsStatus(ns, reconciledStatus(nsStatus(ns), ns.GetGeneration(), isBound(ns), err))
+		return err
+	case isBound(ns):
 		log.Debugf("Unbind namespace:%s", namespace)
-		a.unbindVault(new)
+		return a.unbindVault(ns)
 	}
+	return nil
+}
+
+// reviewLabel labels review roles with their namespace, they are cluster scoped.
+const reviewLabel = "vault-link/namespace"
+
+func reviewRoleName(namespace, sa string) string {
+	return fmt.Sprintf("%s-%s-tokenreview-binding", namespace, sa)
 }
 
-func (a *App) createReviewRole(namespace, sa string) {
-	name := fmt.Sprintf("%s-%s-tokenreview-binding", namespace, sa)
-	log.Debugf("Create review role:%s", name)
+func (a *App) createReviewRole(namespace, sa string) error {
+	name := reviewRoleName(namespace, sa)
+	log.Debugf("Ensure review role:%s", name)
 	roleClient := a.ClientSet().RbacV1().ClusterRoleBindings()
+	if current, err := roleClient.Get(name, metav1.GetOptions{}); err == nil {
+		if current.GetLabels()[reviewLabel] == namespace {
+			return nil
+		}
+		labels := ensureMap(current.GetLabels())
+		labels[reviewLabel] = namespace
+		current.SetLabels(labels)
+		_, err = roleClient.Update(current)
+		return err
+	}
 	_, err := roleClient.Create(
 		&rbacv1.ClusterRoleBinding{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      name,
 				Namespace: namespace,
+				Labels:    map[string]string{reviewLabel: namespace},
 			},
 			RoleRef: rbacv1.RoleRef{
 				APIGroup: "rbac.authorization.k8s.io",
@@ -167,17 +346,52 @@ func (a *App) createReviewRole(namespace, sa string) {
 			}},
 		},
 	)
-	if err != nil {
+	if err != nil && !errors.IsAlreadyExists(err) {
 		log.Errorf("Create review role name:%s, error:%s", name, err)
+		a.nsEventf(namespace, corev1.EventTypeWarning, "ReviewRoleError", "Create review role:%s error:%s", name, err)
+		return err
 	}
+	a.nsEventf(namespace, corev1.EventTypeNormal, "ReviewRoleCreated", "Created review role:%s", name)
+	return nil
 }
 
-func (a *App) deleteReviewRole(namespace, sa string) {
-	name := fmt.Sprintf("%s-%s-tokenreview-binding", namespace, sa)
+func (a *App) deleteReviewRole(namespace, sa string) error {
+	name := reviewRoleName(namespace, sa)
 	log.Debugf("Delete review role:%s", name)
 	roleClient := a.ClientSet().RbacV1().ClusterRoleBindings()
 	err := roleClient.Delete(name, &metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
 	if err != nil {
 		log.Errorf("Delete review role name:%s, error:%s", name, err)
+		a.nsEventf(namespace, corev1.EventTypeWarning, "ReviewRoleError", "Delete review role:%s error:%s", name, err)
+		return err
 	}
+	a.nsEventf(namespace, corev1.EventTypeNormal, "ReviewRoleDeleted", "Deleted review role:%s", name)
+	return nil
+}
+
+// pruneReviewRoles deletes labeled review roles of namespace whose service account is not in keep.
+func (a *App) pruneReviewRoles(namespace string, keep []string) error {
+	roles, err := a.ClientSet().RbacV1().ClusterRoleBindings().List(metav1.ListOptions{
+		LabelSelector: reviewLabel + "=" + namespace,
+	})
+	if err != nil {
+		log.Errorf("List review roles namespace:%s, error:%s", namespace, err)
+		return err
+	}
+	wanted := make(map[string]bool)
+	for _, sa := range keep {
+		wanted[reviewRoleName(namespace, sa)] = true
+	}
+	for _, role := range roles.Items {
+		if wanted[role.Name] || len(role.Subjects) == 0 {
+			continue
+		}
+		if err := a.deleteReviewRole(namespace, role.Subjects[0].Name); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"strconv"
+	"time"
+
+	"vaultlink/vault"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// kvOverrides reads vault-link/kv-* namespace annotations into spec.
+func kvOverrides(ns *corev1.Namespace, spec *vault.BindSpec) error {
+	ann := ensureMap(ns.GetAnnotations())
+	var err error
+	if value, ok := ann["vault-link/kv-version"]; ok {
+		if spec.KVVersion, err = strconv.Atoi(value); err != nil {
+			return invalidAnnotation("vault-link/kv-version", err)
+		}
+	}
+	if value, ok := ann["vault-link/kv-max-versions"]; ok {
+		if spec.KVMaxVersions, err = strconv.Atoi(value); err != nil {
+			return invalidAnnotation("vault-link/kv-max-versions", err)
+		}
+	}
+	if value, ok := ann["vault-link/kv-cas-required"]; ok {
+		if spec.KVCASRequired, err = strconv.ParseBool(value); err != nil {
+			return invalidAnnotation("vault-link/kv-cas-required", err)
+		}
+	}
+	if value, ok := ann["vault-link/kv-delete-version-after"]; ok {
+		if spec.KVDeleteVersionAfter, err = time.ParseDuration(value); err != nil {
+			return invalidAnnotation("vault-link/kv-delete-version-after", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// runLeaderElection competes for the lease and reconciles only while holding it. Reconciles finish
+// before the lease is released on shutdown, and the process exits when the lease is lost, so a new
+// leader never runs next to workers of the old one.
+func (a *App) runLeaderElection() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	shutdown := make(chan struct{})
+	started, stopped := make(chan struct{}), make(chan struct{})
+	// waitControl waits for reconciles if leading started
+	waitControl := func() {
+		select {
+		case <-started:
+			<-stopped
+		default:
+		}
+	}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		log.Infof("Got OS shutdown signal, stopping reconciles and releasing leader lease")
+		close(shutdown)
+		waitControl()
+		cancel()
+	}()
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      a.Args().LeaderElectionID,
+			Namespace: a.Args().LeaderElectionNs,
+		},
+		Client: a.ClientSet().CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity:      a.Args().Identity,
+			EventRecorder: a.recorder,
+		},
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            a.Args().LeaderElectionID,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				close(started)
+				defer close(stopped)
+				log.Infof("Started leading as:%s", a.Args().Identity)
+				stop := make(chan struct{})
+				go func() {
+					select {
+					case <-leaderCtx.Done():
+					case <-shutdown:
+					}
+					close(stop)
+				}()
+				a.control(stop)
+			},
+			OnStoppedLeading: func() {
+				waitControl()
+				if ctx.Err() != nil {
+					log.Infof("Stopped leading as:%s on shutdown", a.Args().Identity)
+					os.Exit(0)
+				}
+				log.Fatalf("Lost leader lease as:%s", a.Args().Identity)
+			},
+			OnNewLeader: func(identity string) {
+				log.Infof("Leader is:%s", identity)
+			},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Leader election error:%s", err)
+	}
+	a.server.SetLeader(elector.IsLeader)
+	go a.server.Listen()
+	elector.Run(ctx)
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"fmt"
+
+	"vaultlink/apis/v1alpha1"
+
+	multierror "github.com/hashicorp/go-multierror"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// MigrateKV upgrades secrets paths of annotation bound namespaces from kv version 1 to 2,
+// rewrites their policies and records the version in vault-link/kv-version annotation.
+// All bound namespaces are migrated if namespaces is empty.
+func (a *App) MigrateKV(namespaces []string) error {
+	if len(namespaces) == 0 {
+		list, err := a.ClientSet().CoreV1().Namespaces().List(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		for _, ns := range list.Items {
+			if isBound(&ns) {
+				namespaces = append(namespaces, ns.GetName())
+			}
+		}
+	}
+	a.waitTargets(a.Args().MigrateTimeout)
+	var errs *multierror.Error
+	for _, namespace := range namespaces {
+		if err := a.migrateNs(namespace); err != nil {
+			log.Errorf("Migrate namespace:%s error:%s", namespace, err)
+			errs = multierror.Append(errs, fmt.Errorf("namespace:%s %s", namespace, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (a *App) migrateNs(namespace string) error {
+	ns, err := a.ClientSet().CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !isBound(ns) {
+		return fmt.Errorf("namespace is not bound")
+	}
+	if a.Args().VaultBindings {
+		bindings, err := a.dynamic.Resource(v1alpha1.VaultBindingResource).Namespace(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		if len(bindings.Items) > 0 {
+			return fmt.Errorf("namespace is bound by VaultBinding, set its kvVersion instead")
+		}
+	}
+	spec, err := a.nsSpec(ns)
+	if err != nil {
+		return err
+	}
+	spec.KVVersion = 2
+	for _, name := range spec.Targets {
+		v, err := a.target(name)
+		if err != nil {
+			return err
+		}
+		if err := v.MigrateKV(spec, a.Args().MigrateTimeout); err != nil {
+			return fmt.Errorf("vault target:%s %w", name, err)
+		}
+	}
+	if _, err := a.bind(spec); err != nil {
+		return err
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		nsTmp, err := a.ClientSet().CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		ann := ensureMap(nsTmp.GetAnnotations())
+		ann["vault-link/kv-version"] = "2"
+		nsTmp.SetAnnotations(ann)
+		_, err = a.ClientSet().CoreV1().Namespaces().Update(nsTmp)
+		return err
+	})
+	if err == nil {
+		a.nsEventf(namespace, corev1.EventTypeNormal, "MigratedKV", "Migrated secrets path to kv version 2")
+	}
+	return err
+}
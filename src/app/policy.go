@@ -0,0 +1,54 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"vaultlink/vault"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// loadPolicyTemplates sets policy tiers from a template file or ConfigMap on top of the built-in tiers,
+// every ConfigMap key is a tier name.
+func (a *App) loadPolicyTemplates() error {
+	var policies *vault.PolicyTemplates
+	var err error
+	switch {
+	case len(a.Args().PolicyTemplateFile) > 0:
+		policies, err = vault.LoadPolicyTemplates(a.Args().PolicyTemplateFile)
+	case len(a.Args().PolicyTemplateConfigMap) > 0:
+		parts := strings.SplitN(a.Args().PolicyTemplateConfigMap, "/", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("policy template configmap:%s must be namespace/name", a.Args().PolicyTemplateConfigMap)
+		}
+		cm, cmErr := a.ClientSet().CoreV1().ConfigMaps(parts[0]).Get(parts[1], metav1.GetOptions{})
+		if cmErr != nil {
+			return cmErr
+		}
+		policies, err = vault.NewPolicyTemplates(cm.Data)
+	default:
+		policies, err = vault.NewPolicyTemplates(nil)
+	}
+	if err != nil {
+		return err
+	}
+	a.policies = policies
+	for _, v := range a.vaults {
+		v.SetPolicyTemplates(policies)
+	}
+	return nil
+}
+
+// checkTiers rejects a policy tier or group tiers that no policy template defines.
+func (a *App) checkTiers(tier string, groups []vault.Group) error {
+	if len(tier) > 0 && !a.policies.HasTier(tier) {
+		return fmt.Errorf("unknown policy tier:%s", tier)
+	}
+	for _, group := range groups {
+		if len(group.Tier) > 0 && !a.policies.HasTier(group.Tier) {
+			return fmt.Errorf("unknown policy tier:%s of group:%s", group.Tier, group.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"vaultlink/vault"
+
+	log "github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Reviewer modes tell how vault gets the JWT to call kubernetes TokenReview with.
+const (
+	// reviewerSecret reads legacy service account token secret.
+	reviewerSecret = "secret"
+	// reviewerTokenRequest requests bound service account token with TokenRequest API and refreshes it.
+	reviewerTokenRequest = "tokenrequest"
+	// reviewerClient makes vault use JWT of the client that logs in.
+	reviewerClient = "client"
+)
+
+type reviewerToken struct {
+	token   []byte
+	refresh time.Time
+}
+
+func tokenKey(namespace, sa string) string {
+	return namespace + "/" + sa
+}
+
+// reviewers returns service accounts that call TokenReview and need the review role.
+func reviewers(spec *vault.BindSpec) []string {
+	if spec.ClientReviewer {
+		return spec.RoleServiceAccounts()
+	}
+	return []string{spec.ServiceAccount}
+}
+
+// setReviewer sets token reviewer JWT and CA certificate of spec according to reviewer mode,
+// it returns requested token to be stored once it is written to vault.
+func (a *App) setReviewer(spec *vault.BindSpec) (*reviewerToken, error) {
+	var fresh *reviewerToken
+	var secretCA []byte
+	var err error
+	switch a.Args().ReviewerMode {
+	case reviewerSecret:
+		spec.Token, secretCA, err = a.secretToken(spec.Namespace, spec.ServiceAccount)
+	case reviewerTokenRequest:
+		spec.Token, fresh, err = a.requestedToken(spec.Namespace, spec.ServiceAccount)
+		spec.RewriteConfig = fresh != nil
+	case reviewerClient:
+		// spec.ClientReviewer is set by newSpec, unbind needs it as well
+	default:
+		err = fmt.Errorf("unknown reviewer mode:%s", a.Args().ReviewerMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	spec.CA, err = a.clusterCA(spec.Namespace, secretCA)
+	return fresh, err
+}
+
+// secretToken returns token and CA certificate of the legacy service account token secret.
+func (a *App) secretToken(namespace, saName string) (token, ca []byte, err error) {
+	sa, err := a.ClientSet().CoreV1().ServiceAccounts(namespace).Get(saName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil, &reasonError{"MissingServiceAccount", err}
+	}
+	if err != nil {
+		log.Errorf("Get service account:%s namespace:%s %s", saName, namespace, err)
+		return nil, nil, err
+	}
+	if len(sa.Secrets) == 0 {
+		return nil, nil, &reasonError{"MissingServiceAccount", fmt.Errorf("service account:%s has no token secret, use -reviewerMode=%s", saName, reviewerTokenRequest)}
+	}
+	secret, err := a.ClientSet().CoreV1().Secrets(namespace).Get(sa.Secrets[0].Name, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("Get secret:%s namespace:%s %s", sa.Secrets[0].Name, namespace, err)
+		return nil, nil, err
+	}
+	return secret.Data["token"], secret.Data["ca.crt"], nil
+}
+
+// requestedToken returns cached reviewer token, or requests a new one if there is none or it is due to refresh.
+func (a *App) requestedToken(namespace, saName string) ([]byte, *reviewerToken, error) {
+	a.tokensMu.Lock()
+	cached, ok := a.tokens[tokenKey(namespace, saName)]
+	a.tokensMu.Unlock()
+	if ok && time.Now().Before(cached.refresh) {
+		return cached.token, nil, nil
+	}
+	expiration := int64(a.Args().ReviewerExpiry.Seconds())
+	tr := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         a.audiences(),
+			ExpirationSeconds: &expiration,
+		},
+	}
+	re, err := a.ClientSet().CoreV1().ServiceAccounts(namespace).CreateToken(saName, tr)
+	if errors.IsNotFound(err) {
+		return nil, nil, &reasonError{"MissingServiceAccount", err}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	expires := re.Status.ExpirationTimestamp.Time
+	log.Infof("Requested reviewer token service account:%s namespace:%s expires:%s", saName, namespace, expires)
+	fresh := &reviewerToken{
+		token:   []byte(re.Status.Token),
+		refresh: time.Now().Add(time.Until(expires) * 2 / 3),
+	}
+	return fresh.token, fresh, nil
+}
+
+func (a *App) audiences() []string {
+	var re []string
+	for _, audience := range strings.Split(a.Args().ReviewerAudience, ",") {
+		if audience = strings.TrimSpace(audience); len(audience) > 0 {
+			re = append(re, audience)
+		}
+	}
+	return re
+}
+
+func (a *App) storeToken(namespace, saName string, token *reviewerToken) {
+	a.tokensMu.Lock()
+	defer a.tokensMu.Unlock()
+	a.tokens[tokenKey(namespace, saName)] = *token
+}
+
+func (a *App) forgetToken(namespace, saName string) {
+	a.tokensMu.Lock()
+	defer a.tokensMu.Unlock()
+	delete(a.tokens, tokenKey(namespace, saName))
+}
+
+// CA sources tell where the kubernetes CA certificate written to vault comes from.
+const (
+	// caAuto takes the first available of secret, configmap and in-cluster config.
+	caAuto      = "auto"
+	caSecret    = "secret"
+	caConfigMap = "configmap"
+	caInCluster = "incluster"
+	caFile      = "file"
+)
+
+// rootCAConfigMap is published to every namespace by kubernetes 1.20+.
+const rootCAConfigMap = "kube-root-ca.crt"
+
+// clusterCA returns CA certificate from the configured source, it is read on every reconcile
+// so rotated certificates get to vault as auth config drift.
+func (a *App) clusterCA(namespace string, secretCA []byte) ([]byte, error) {
+	switch a.Args().CASource {
+	case caAuto:
+		if len(secretCA) > 0 {
+			return secretCA, nil
+		}
+		if ca, err := a.configMapCA(namespace); err == nil {
+			return ca, nil
+		}
+		return a.inClusterCA()
+	case caSecret:
+		if len(secretCA) == 0 {
+			return nil, fmt.Errorf("no ca.crt in service account token secret, reviewer mode:%s", a.Args().ReviewerMode)
+		}
+		return secretCA, nil
+	case caConfigMap:
+		return a.configMapCA(namespace)
+	case caInCluster:
+		return a.inClusterCA()
+	case caFile:
+		return ioutil.ReadFile(a.Args().CAFile)
+	}
+	return nil, fmt.Errorf("unknown CA source:%s", a.Args().CASource)
+}
+
+func (a *App) configMapCA(namespace string) ([]byte, error) {
+	cm, err := a.ClientSet().CoreV1().ConfigMaps(namespace).Get(rootCAConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ca, ok := cm.Data["ca.crt"]
+	if !ok {
+		return nil, fmt.Errorf("no ca.crt in configmap:%s namespace:%s", rootCAConfigMap, namespace)
+	}
+	return []byte(ca), nil
+}
+
+func (a *App) inClusterCA() ([]byte, error) {
+	if len(a.config.CAData) > 0 {
+		return a.config.CAData, nil
+	}
+	return ioutil.ReadFile(a.config.CAFile)
+}
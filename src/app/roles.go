@@ -0,0 +1,143 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"vaultlink/apis/v1alpha1"
+	"vaultlink/vault"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func splitList(value string) []string {
+	var re []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			re = append(re, item)
+		}
+	}
+	return re
+}
+
+// parseServiceAccounts parses vault-link/service-accounts annotation, either a comma separated
+// list of names or a JSON list of VaultBinding service accounts.
+func parseServiceAccounts(value string) ([]v1alpha1.ServiceAccount, error) {
+	var sas []v1alpha1.ServiceAccount
+	if strings.HasPrefix(strings.TrimSpace(value), "[") {
+		if err := json.Unmarshal([]byte(value), &sas); err != nil {
+			return nil, invalidAnnotation("vault-link/service-accounts", err)
+		}
+		return sas, nil
+	}
+	for _, name := range splitList(value) {
+		sas = append(sas, v1alpha1.ServiceAccount{Name: name})
+	}
+	return sas, nil
+}
+
+// roles turns service accounts into vault roles, policies besides the namespace one must be allowed.
+func (a *App) roles(sas []v1alpha1.ServiceAccount) ([]vault.Role, error) {
+	var roles []vault.Role
+	for _, sa := range sas {
+		if err := a.checkPolicies(sa.Policies); err != nil {
+			return nil, err
+		}
+		role := vault.Role{
+			ServiceAccount:  sa.Name,
+			BoundNamespaces: sa.BoundNamespaces,
+			Policies:        sa.Policies,
+		}
+		if sa.TokenTTL != nil {
+			role.TokenTTL = sa.TokenTTL.Duration
+		}
+		if sa.TokenMaxTTL != nil {
+			role.TokenMaxTTL = sa.TokenMaxTTL.Duration
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func invalidAnnotation(key string, err error) error {
+	return &reasonError{"InvalidAnnotation", fmt.Errorf("%s:%s", key, err)}
+}
+
+// tokenOverrides reads vault-link/token-* namespace annotations into spec.
+func tokenOverrides(ns *corev1.Namespace, spec *vault.BindSpec) error {
+	ann := ensureMap(ns.GetAnnotations())
+	var err error
+	if value, ok := ann["vault-link/token-ttl"]; ok {
+		if spec.TokenTTL, err = time.ParseDuration(value); err != nil {
+			return invalidAnnotation("vault-link/token-ttl", err)
+		}
+	}
+	if value, ok := ann["vault-link/token-max-ttl"]; ok {
+		if spec.TokenMaxTTL, err = time.ParseDuration(value); err != nil {
+			return invalidAnnotation("vault-link/token-max-ttl", err)
+		}
+	}
+	if value, ok := ann["vault-link/token-num-uses"]; ok {
+		if spec.TokenNumUses, err = strconv.Atoi(value); err != nil {
+			return invalidAnnotation("vault-link/token-num-uses", err)
+		}
+	}
+	if value, ok := ann["vault-link/token-policies"]; ok {
+		spec.TokenPolicies = splitList(value)
+	}
+	if value, ok := ann["vault-link/token-bound-cidrs"]; ok {
+		spec.TokenBoundCIDRs = splitList(value)
+		for _, cidr := range spec.TokenBoundCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+				return invalidAnnotation("vault-link/token-bound-cidrs", fmt.Errorf("invalid cidr:%s", cidr))
+			}
+		}
+	}
+	return nil
+}
+
+// checkLimits validates effective token settings of spec roles against cluster-wide limits.
+func (a *App) checkLimits(spec *vault.BindSpec) error {
+	args := a.Args()
+	checkTTL := func(name string, ttl time.Duration) error {
+		if ttl < args.MinTokenTTL || (args.MaxTokenTTL > 0 && ttl > args.MaxTokenTTL) {
+			return &reasonError{"LimitExceeded", fmt.Errorf("%s:%s is out of range %s-%s", name, ttl, args.MinTokenTTL, args.MaxTokenTTL)}
+		}
+		return nil
+	}
+	for _, role := range spec.EffectiveRoles() {
+		ttl, maxTTL := spec.RoleTTLs(role)
+		if err := checkTTL("role:"+role.ServiceAccount+" token ttl", ttl); err != nil {
+			return err
+		}
+		// 0 max ttl is not set, the mount max ttl applies
+		if maxTTL == 0 {
+			continue
+		}
+		if err := checkTTL("role:"+role.ServiceAccount+" token max ttl", maxTTL); err != nil {
+			return err
+		}
+	}
+	// 0 num uses is not set, tokens are unlimited
+	if spec.TokenNumUses < 0 || (args.MaxTokenNumUses > 0 && spec.TokenNumUses > args.MaxTokenNumUses) {
+		return &reasonError{"LimitExceeded", fmt.Errorf("token num uses:%d is out of range 1-%d", spec.TokenNumUses, args.MaxTokenNumUses)}
+	}
+	return a.checkPolicies(spec.TokenPolicies)
+}
+
+func (a *App) checkPolicies(policies []string) error {
+	allowed := make(map[string]bool)
+	for _, policy := range splitList(a.Args().AllowedPolicies) {
+		allowed[policy] = true
+	}
+	for _, policy := range policies {
+		if !allowed[policy] {
+			return &reasonError{"PolicyNotAllowed", fmt.Errorf("policy:%s is not allowed", policy)}
+		}
+	}
+	return nil
+}
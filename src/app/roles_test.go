@@ -0,0 +1,48 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"vaultlink/args"
+	"vaultlink/vault"
+)
+
+func TestCheckLimits(t *testing.T) {
+	limited := &args.Args{MinTokenTTL: time.Minute, MaxTokenTTL: 8 * time.Hour, MaxTokenNumUses: 10, AllowedPolicies: "shared-read"}
+	unlimited := &args.Args{MinTokenTTL: time.Minute}
+	tests := []struct {
+		name   string
+		args   *args.Args
+		spec   vault.BindSpec
+		reason string
+	}{
+		{"no limits", unlimited, vault.BindSpec{}, ""},
+		{"no limits long max ttl", unlimited, vault.BindSpec{TokenMaxTTL: 1000 * time.Hour}, ""},
+		{"default ttl above max", limited, vault.BindSpec{}, "LimitExceeded"},
+		{"ttl in range", limited, vault.BindSpec{TokenTTL: time.Hour}, ""},
+		{"ttl below min", limited, vault.BindSpec{TokenTTL: 30 * time.Second}, "LimitExceeded"},
+		{"max ttl above max", limited, vault.BindSpec{TokenTTL: time.Hour, TokenMaxTTL: 9 * time.Hour}, "LimitExceeded"},
+		{"default ttl cut to max ttl", limited, vault.BindSpec{TokenMaxTTL: 4 * time.Hour}, ""},
+		{"role max ttl above max", limited, vault.BindSpec{TokenTTL: time.Hour, Roles: []vault.Role{{ServiceAccount: "app", TokenMaxTTL: 9 * time.Hour}}}, "LimitExceeded"},
+		{"role ttl above max", limited, vault.BindSpec{Roles: []vault.Role{{ServiceAccount: "app", TokenTTL: 9 * time.Hour}}}, "LimitExceeded"},
+		{"unset num uses", limited, vault.BindSpec{TokenTTL: time.Hour}, ""},
+		{"num uses in range", limited, vault.BindSpec{TokenTTL: time.Hour, TokenNumUses: 10}, ""},
+		{"num uses above max", limited, vault.BindSpec{TokenTTL: time.Hour, TokenNumUses: 11}, "LimitExceeded"},
+		{"negative num uses", unlimited, vault.BindSpec{TokenNumUses: -1}, "LimitExceeded"},
+		{"allowed policy", limited, vault.BindSpec{TokenTTL: time.Hour, TokenPolicies: []string{"shared-read"}}, ""},
+		{"policy not allowed", limited, vault.BindSpec{TokenTTL: time.Hour, TokenPolicies: []string{"root"}}, "PolicyNotAllowed"},
+	}
+	for _, test := range tests {
+		a := &App{args: test.args}
+		err := a.checkLimits(&test.spec)
+		var reasonErr *reasonError
+		switch {
+		case len(test.reason) == 0 && err != nil:
+			t.Errorf("%s: error:%s", test.name, err)
+		case len(test.reason) > 0 && (!errors.As(err, &reasonErr) || reasonErr.reason != test.reason):
+			t.Errorf("%s: error:%v want reason:%s", test.name, err, test.reason)
+		}
+	}
+}
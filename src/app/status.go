@@ -0,0 +1,126 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"vaultlink/apis/v1alpha1"
+	"vaultlink/vault"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// statusRefresh is how often the last reconcile time alone is written, every status write
+// triggers another reconcile so it is not written on each resync.
+const statusRefresh = 5 * time.Minute
+
+// reasonError is a bind failure with a machine readable reason.
+type reasonError struct {
+	reason string
+	err    error
+}
+
+func (e *reasonError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reasonError) Unwrap() error {
+	return e.err
+}
+
+func failureReason(err error) string {
+	var reasonErr *reasonError
+	if errors.As(err, &reasonErr) {
+		return reasonErr.reason
+	}
+	var stepErr *vault.StepError
+	if errors.As(err, &stepErr) {
+		return "VaultError"
+	}
+	return "BindFailed"
+}
+
+func condition(conditionType string, status corev1.ConditionStatus, reason, message string) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	}
+}
+
+// reconciledStatus returns status updated with the outcome of a bind, Degraded is only set
+// for resources that were bound before and failed to reconcile now.
+func reconciledStatus(current v1alpha1.Status, generation int64, bound bool, err error) v1alpha1.Status {
+	status := current.Copy()
+	now := metav1.Now()
+	status.ObservedGeneration = generation
+	status.LastReconcileTime = &now
+	if err == nil {
+		status.LastError = ""
+		status.Conditions.Set(condition(v1alpha1.ConditionReady, corev1.ConditionTrue, "Bound", ""))
+		status.Conditions.Set(condition(v1alpha1.ConditionDegraded, corev1.ConditionFalse, "Bound", ""))
+		return status
+	}
+	reason := failureReason(err)
+	status.LastError = err.Error()
+	status.Conditions.Set(condition(v1alpha1.ConditionReady, corev1.ConditionFalse, reason, err.Error()))
+	if bound {
+		status.Conditions.Set(condition(v1alpha1.ConditionDegraded, corev1.ConditionTrue, reason, err.Error()))
+	} else {
+		status.Conditions.Set(condition(v1alpha1.ConditionDegraded, corev1.ConditionFalse, "NotBound", ""))
+	}
+	return status
+}
+
+// statusChanged tells if the new status differs in more than reconcile time, or the reconcile time is stale.
+func statusChanged(old, new v1alpha1.Status) bool {
+	if old.LastReconcileTime == nil || new.LastReconcileTime == nil ||
+		new.LastReconcileTime.Sub(old.LastReconcileTime.Time) > statusRefresh {
+		return true
+	}
+	old.LastReconcileTime, new.LastReconcileTime = nil, nil
+	return !reflect.DeepEqual(old, new)
+}
+
+func nsStatus(ns *corev1.Namespace) v1alpha1.Status {
+	var status v1alpha1.Status
+	if value, ok := ensureMap(ns.GetAnnotations())["vault-link/status"]; ok {
+		if err := json.Unmarshal([]byte(value), &status); err != nil {
+			log.Warnf("Ignore invalid status of namespace:%s, error:%s", ns.GetName(), err)
+		}
+	}
+	return status
+}
+
+// setNsStatus writes status to vault-link/status annotation of the namespace.
+func (a *App) setNsStatus(ns *corev1.Namespace, status v1alpha1.Status) {
+	if !statusChanged(nsStatus(ns), status) {
+		return
+	}
+	value, err := json.Marshal(status)
+	if err != nil {
+		log.Errorf("Marshal status of namespace:%s, error:%s", ns.GetName(), err)
+		return
+	}
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		nsTmp, err := a.ClientSet().CoreV1().Namespaces().Get(ns.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		ann := ensureMap(nsTmp.GetAnnotations())
+		ann["vault-link/status"] = string(value)
+		nsTmp.SetAnnotations(ann)
+		_, err = a.ClientSet().CoreV1().Namespaces().Update(nsTmp)
+		return err
+	})
+	if retryErr != nil {
+		log.Errorf("Updating namespace:%s status, error:%s", ns.GetName(), retryErr)
+	}
+}
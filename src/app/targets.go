@@ -0,0 +1,218 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"vaultlink/args"
+	"vaultlink/vault"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// newVault configures the vault target and starts connecting and logging in to it in the background,
+// the target is unavailable until it succeeds. Configuration errors are fatal.
+func newVault(name string, targetArgs *args.Args) *vault.Vault {
+	log.Infof("Vault target:%s addr:%s", name, targetArgs.VaultAddr)
+	v := vault.New(targetArgs.VaultAddr, targetArgs.VaultPolicyT, targetArgs.VaultSecretsPathT, targetArgs.VaultAuthT).
+		SetTLS(vaultTLS(targetArgs)).
+		SetNamespace(targetArgs.VaultNamespace)
+	if err := v.SetNamespaceTemplate(targetArgs.VaultNamespaceT); err != nil {
+		log.Errorf("Vault target:%s namespace template error:%s", name, err)
+		os.Exit(1)
+	}
+	providers, err := vault.ParseGroupProviders(targetArgs.GroupProviders)
+	if err != nil {
+		log.Errorf("Vault target:%s group providers error:%s", name, err)
+		os.Exit(1)
+	}
+	v.SetGroupProviders(providers)
+	login, err := loginFunc(v, targetArgs)
+	if err != nil {
+		log.Errorf("Vault target:%s login error:%s", name, err)
+		os.Exit(1)
+	}
+	go v.Start(login, targetArgs.Unwrap, targetArgs.VaultToken)
+	return v
+}
+
+func vaultTLS(targetArgs *args.Args) *vault.TLSFiles {
+	return &vault.TLSFiles{
+		CACert:     targetArgs.VaultCACert,
+		CAPath:     targetArgs.VaultCAPath,
+		ClientCert: targetArgs.VaultClientCert,
+		ClientKey:  targetArgs.VaultClientKey,
+		ServerName: targetArgs.VaultTLSServerName,
+		Insecure:   targetArgs.VaultSkipVerify,
+	}
+}
+
+// loginFunc returns the login of -authMethod, nil for a static token.
+func loginFunc(v *vault.Vault, targetArgs *args.Args) (vault.LoginFunc, error) {
+	method := targetArgs.AuthMethod
+	if len(method) == 0 {
+		method = vault.AuthToken
+		if len(targetArgs.AuthPath) > 0 {
+			method = vault.AuthKubernetes
+		}
+	}
+	switch method {
+	case vault.AuthToken:
+		return nil, nil
+	case vault.AuthKubernetes:
+		return func() (*api.Secret, error) {
+			return v.Login(targetArgs.KubeTokenPath, targetArgs.AuthPath)
+		}, nil
+	case vault.AuthJWT:
+		return v.JWTLogin(targetArgs.JWTPath, targetArgs.AuthPath), nil
+	case vault.AuthAppRole:
+		return v.AppRoleLogin(targetArgs.AuthPath, targetArgs.RoleIDPath, targetArgs.SecretIDPath, targetArgs.SecretIDWrapped), nil
+	case vault.AuthCert:
+		if len(targetArgs.VaultClientCert) == 0 {
+			return nil, fmt.Errorf("cert login method requires -vaultClientCert")
+		}
+		return v.CertLogin(targetArgs.AuthPath), nil
+	}
+	return nil, fmt.Errorf("unknown auth method:%s", method)
+}
+
+// target returns the vault of a named target if it is available.
+func (a *App) target(name string) (*vault.Vault, error) {
+	v, ok := a.vaults[name]
+	if !ok {
+		return nil, &reasonError{"UnknownTarget", fmt.Errorf("unknown vault target:%s", name)}
+	}
+	if err := v.Available(); err != nil {
+		return nil, &reasonError{"TargetUnavailable", fmt.Errorf("vault target:%s is unavailable, error:%s", name, err)}
+	}
+	return v, nil
+}
+
+// waitTargets waits until all vault targets are available or timeout passes.
+func (a *App) waitTargets(timeout time.Duration) {
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		for _, v := range a.vaults {
+			if v.Available() != nil {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		for name, v := range a.vaults {
+			if targetErr := v.Available(); targetErr != nil {
+				log.Warnf("Vault target:%s is unavailable, error:%s", name, targetErr)
+			}
+		}
+	}
+}
+
+// specTargets returns comma separated target names, or -defaultVaultTargets if value is empty.
+func (a *App) specTargets(value string) []string {
+	if targets := splitList(value); len(targets) > 0 {
+		return targets
+	}
+	return splitList(a.Args().DefaultTargets)
+}
+
+// boundTargets returns targets recorded by the previous bind, bindings made before targets
+// were recorded are bound to the default target.
+func boundTargets(value string, bound bool) []string {
+	if targets := splitList(value); len(targets) > 0 || !bound {
+		return targets
+	}
+	return []string{args.DefaultTarget}
+}
+
+// bindTargets binds spec on each of its targets and unbinds targets it does not want any more,
+// it returns the binding of the first target.
+func (a *App) bindTargets(spec *vault.BindSpec) (*vault.BindInfo, error) {
+	if len(spec.Targets) == 0 {
+		return nil, &reasonError{"UnknownTarget", fmt.Errorf("no vault targets")}
+	}
+	var info *vault.BindInfo
+	for _, name := range spec.Targets {
+		v, err := a.target(name)
+		if err != nil {
+			return nil, err
+		}
+		targetInfo, err := v.Bind(spec)
+		if err != nil {
+			return nil, fmt.Errorf("vault target:%s %w", name, err)
+		}
+		if info == nil {
+			info = targetInfo
+		}
+	}
+	for _, name := range staleTargets(spec) {
+		if err := a.unbindTarget(name, spec); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// unbindTargets unbinds spec from wanted and bound targets.
+func (a *App) unbindTargets(spec *vault.BindSpec) error {
+	for _, name := range spec.Targets {
+		if err := a.unbindTarget(name, spec); err != nil {
+			return err
+		}
+	}
+	for _, name := range staleTargets(spec) {
+		if err := a.unbindTarget(name, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unbindTarget skips targets removed from configuration, their vault resources are left behind.
+func (a *App) unbindTarget(name string, spec *vault.BindSpec) error {
+	if _, ok := a.vaults[name]; !ok {
+		log.Warnf("Skip unbind of namespace:%s from unknown vault target:%s", spec.Namespace, name)
+		return nil
+	}
+	v, err := a.target(name)
+	if err != nil {
+		return err
+	}
+	if err := v.Unbind(spec); err != nil {
+		return fmt.Errorf("vault target:%s %w", name, err)
+	}
+	return nil
+}
+
+// targetAddr returns vault address of the first target of info.
+func (a *App) targetAddr(info *vault.BindInfo) string {
+	if len(info.Targets) == 0 {
+		return a.Vault().Addr()
+	}
+	if v, ok := a.vaults[info.Targets[0]]; ok {
+		return v.Addr()
+	}
+	return ""
+}
+
+// staleTargets returns bound targets of spec that it does not want any more.
+func staleTargets(spec *vault.BindSpec) []string {
+	var re []string
+	for _, bound := range spec.BoundTargets {
+		if !contains(spec.Targets, bound) {
+			re = append(re, bound)
+		}
+	}
+	return re
+}
+
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
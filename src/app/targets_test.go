@@ -0,0 +1,31 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"vaultlink/vault"
+)
+
+func TestStaleTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		value   string
+		bound   bool
+		stale   []string
+	}{
+		{"not bound", []string{"default"}, "", false, nil},
+		{"bound before targets were recorded", []string{"eu"}, "", true, []string{"default"}},
+		{"same targets", []string{"default", "eu"}, "eu,default", true, nil},
+		{"removed target", []string{"eu"}, "default, eu, us", true, []string{"default", "us"}},
+		{"added target", []string{"eu", "us"}, "eu", true, nil},
+		{"unbind all", nil, "eu,us", true, []string{"eu", "us"}},
+	}
+	for _, test := range tests {
+		spec := &vault.BindSpec{Targets: test.targets, BoundTargets: boundTargets(test.value, test.bound)}
+		if stale := staleTargets(spec); !reflect.DeepEqual(stale, test.stale) {
+			t.Errorf("%s: stale:%v want:%v", test.name, stale, test.stale)
+		}
+	}
+}
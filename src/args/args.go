@@ -3,25 +3,67 @@ package args
 import (
 	"flag"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type Args struct {
-	VerboseLevel      string
-	AuthPath          string
-	KubeTokenPath     string
-	VaultAddr         string
-	VaultToken        string
-	Cluster           string
-	ServiceAccount    string
-	KubeAddr          string
-	VaultPolicyT      string
-	VaultAuthT        string
-	VaultSecretsPathT string
-	Unwrap            bool
-	Args              []string
-	Port              int
+	VerboseLevel            string
+	AuthPath                string
+	AuthMethod              string
+	RoleIDPath              string
+	SecretIDPath            string
+	SecretIDWrapped         bool
+	JWTPath                 string
+	VaultClientCert         string
+	VaultClientKey          string
+	VaultCACert             string
+	VaultNamespace          string
+	VaultTargets            string
+	DefaultTargets          string
+	VaultNamespaceT         string
+	VaultCAPath             string
+	VaultTLSServerName      string
+	VaultSkipVerify         bool
+	KubeTokenPath           string
+	VaultAddr               string
+	VaultToken              string
+	Cluster                 string
+	ServiceAccount          string
+	KubeAddr                string
+	VaultPolicyT            string
+	VaultAuthT              string
+	VaultSecretsPathT       string
+	Unwrap                  bool
+	Args                    []string
+	Port                    int
+	Workers                 int
+	RetryBaseDelay          time.Duration
+	RetryMaxDelay           time.Duration
+	CleanupTimeout          time.Duration
+	GCInterval              time.Duration
+	GCReportOnly            bool
+	VaultBindings           bool
+	LeaderElect             bool
+	LeaderElectionID        string
+	LeaderElectionNs        string
+	Identity                string
+	ReviewerMode            string
+	ReviewerAudience        string
+	ReviewerExpiry          time.Duration
+	CASource                string
+	CAFile                  string
+	AllowedPolicies         string
+	GroupProviders          string
+	KVVersion               int
+	MigrateTimeout          time.Duration
+	PolicyTier              string
+	PolicyTemplateFile      string
+	PolicyTemplateConfigMap string
+	MinTokenTTL             time.Duration
+	MaxTokenTTL             time.Duration
+	MaxTokenNumUses         int
 }
 
 func New() *Args {
@@ -35,9 +77,32 @@ func env(name, def string) string {
 	return def
 }
 
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "vaultlink"
+	}
+	return name
+}
+
 func (a *Args) Parse() *Args {
 	flag.StringVar(&a.VerboseLevel, "verbose", env("VERBOSE", "info"), "Set verbosity level")
 	flag.StringVar(&a.AuthPath, "authPath", env("AUTH_PATH", ""), "Authenticate with kubernetes, format: role@authengine")
+	flag.StringVar(&a.AuthMethod, "authMethod", env("AUTH_METHOD", ""), "Vault login method: token, kubernetes, jwt, approle or cert, kubernetes if -authPath is set, token otherwise")
+	flag.StringVar(&a.RoleIDPath, "roleIdPath", env("ROLE_ID_PATH", ""), "AppRole role id file")
+	flag.StringVar(&a.SecretIDPath, "secretIdPath", env("SECRET_ID_PATH", ""), "AppRole secret id file")
+	flag.BoolVar(&a.SecretIDWrapped, "secretIdWrapped", false, "AppRole secret id file holds a response wrapping token")
+	flag.StringVar(&a.JWTPath, "jwtPath", env("JWT_PATH", ""), "JWT file for jwt login method")
+	flag.StringVar(&a.VaultClientCert, "vaultClientCert", env("VAULT_CLIENT_CERT", ""), "Vault TLS client certificate file, required by cert login method")
+	flag.StringVar(&a.VaultClientKey, "vaultClientKey", env("VAULT_CLIENT_KEY", ""), "Vault TLS client key file")
+	flag.StringVar(&a.VaultTargets, "vaultTargets", env("VAULT_TARGETS", ""), "YAML file of named vault targets overriding vault flags")
+	flag.StringVar(&a.DefaultTargets, "defaultVaultTargets", env("DEFAULT_VAULT_TARGETS", "default"), "Comma separated vault targets of namespaces without vault-link/vault-targets annotation")
+	flag.StringVar(&a.VaultNamespace, "vaultNamespace", env("VAULT_NAMESPACE", ""), "Vault enterprise namespace")
+	flag.StringVar(&a.VaultNamespaceT, "vaultNamespaceTemplate", env("VAULT_NAMESPACE_TEMPLATE", ""), "Child vault namespace template of kubernetes namespaces, e.g. k8s-{{ .Namespace }}, created on bind and deleted on unbind")
+	flag.StringVar(&a.VaultCACert, "vaultCACert", env("VAULT_CACERT", ""), "Vault CA certificate file")
+	flag.StringVar(&a.VaultCAPath, "vaultCAPath", env("VAULT_CAPATH", ""), "Directory of vault CA certificate files")
+	flag.StringVar(&a.VaultTLSServerName, "vaultTLSServerName", env("VAULT_TLS_SERVER_NAME", ""), "Vault TLS server name, host of -vaultAddr if empty")
+	flag.BoolVar(&a.VaultSkipVerify, "vaultSkipVerify", env("VAULT_SKIP_VERIFY", "") == "true", "Skip TLS verification of vault server, insecure")
 	flag.StringVar(&a.Cluster, "clusterName", env("CLUSTER_NAME", ""), "Cluster name")
 	flag.StringVar(&a.ServiceAccount, "serviceaccount", env("SERVICE_ACCOUNT", "default"), "Service account")
 	flag.StringVar(&a.KubeAddr, "kubeApiAddr", env("KUBE_API_ADDR", ""), "Kubernetes api address")
@@ -49,6 +114,32 @@ func (a *Args) Parse() *Args {
 	flag.StringVar(&a.VaultAuthT, "vaultAuth", env("VAULT_AUTH", "k8s/{{ .Cluster }}/{{ .Namespace }}"), "Vault auth path template")
 	flag.IntVar(&a.Port, "port", 80, "Health server listen port")
 	flag.BoolVar(&a.Unwrap, "unwrap", false, "Unwrap token")
+	flag.IntVar(&a.Workers, "workers", 2, "Number of namespace reconcile workers")
+	flag.DurationVar(&a.RetryBaseDelay, "retryBaseDelay", time.Second, "Initial delay before retrying a failed reconcile")
+	flag.DurationVar(&a.RetryMaxDelay, "retryMaxDelay", 5*time.Minute, "Maximum delay between retries of a failed reconcile")
+	flag.BoolVar(&a.VaultBindings, "vaultBindings", false, "Reconcile VaultBinding resources, requires VaultBinding CRD")
+	flag.StringVar(&a.ReviewerMode, "reviewerMode", env("REVIEWER_MODE", "secret"), "Token reviewer JWT source: secret, tokenrequest or client")
+	flag.StringVar(&a.ReviewerAudience, "reviewerAudience", env("REVIEWER_AUDIENCE", ""), "Comma separated audiences of requested reviewer tokens, api server audience if empty")
+	flag.DurationVar(&a.ReviewerExpiry, "reviewerExpiry", 24*time.Hour, "Expiry of requested reviewer tokens, they are refreshed after 2/3 of it")
+	flag.StringVar(&a.CASource, "caSource", env("CA_SOURCE", "auto"), "Kubernetes CA certificate source: auto, secret, configmap, incluster or file")
+	flag.StringVar(&a.CAFile, "caFile", env("CA_FILE", ""), "Kubernetes CA certificate file for file CA source")
+	flag.StringVar(&a.AllowedPolicies, "allowedPolicies", env("ALLOWED_POLICIES", ""), "Comma separated vault policies namespaces may attach to their roles")
+	flag.StringVar(&a.GroupProviders, "groupProviders", env("GROUP_PROVIDERS", "okta,oidc"), "Comma separated group providers as type:mount, types: okta, ldap, github, oidc, jwt")
+	flag.IntVar(&a.KVVersion, "kvVersion", 1, "Default kv secrets engine version of new namespace secrets paths, 1 or 2")
+	flag.DurationVar(&a.MigrateTimeout, "migrateTimeout", 5*time.Minute, "Maximum wait for kv version 2 upgrade of a secrets path in migrate-kv command")
+	flag.StringVar(&a.PolicyTier, "policyTier", env("POLICY_TIER", "read-write"), "Default policy tier of namespaces: read-only, read-write, admin or a template tier")
+	flag.StringVar(&a.PolicyTemplateFile, "policyTemplateFile", env("POLICY_TEMPLATE_FILE", ""), "File with policy tier templates as {{ define \"tier\" }} blocks")
+	flag.StringVar(&a.PolicyTemplateConfigMap, "policyTemplateConfigMap", env("POLICY_TEMPLATE_CONFIGMAP", ""), "ConfigMap namespace/name with a policy tier template per key")
+	flag.DurationVar(&a.MinTokenTTL, "minTokenTTL", time.Minute, "Minimum token ttl namespaces may set")
+	flag.DurationVar(&a.MaxTokenTTL, "maxTokenTTL", 0, "Maximum token ttl and max ttl namespaces may set, 0 for no limit")
+	flag.IntVar(&a.MaxTokenNumUses, "maxTokenNumUses", 0, "Maximum token num uses namespaces may set, 0 for no limit")
+	flag.BoolVar(&a.LeaderElect, "leaderElect", false, "Enable leader election to run multiple replicas")
+	flag.StringVar(&a.LeaderElectionID, "leaderElectionId", env("LEADER_ELECTION_ID", "vaultlink"), "Leader election lease name")
+	flag.StringVar(&a.LeaderElectionNs, "leaderElectionNamespace", env("POD_NAMESPACE", "default"), "Leader election lease namespace")
+	flag.StringVar(&a.Identity, "identity", env("POD_NAME", hostname()), "Leader election identity of this replica")
+	flag.DurationVar(&a.GCInterval, "gcInterval", time.Hour, "Interval of vault orphans garbage collection, 0 to disable")
+	flag.BoolVar(&a.GCReportOnly, "gcReportOnly", false, "Only report vault orphans, do not delete them")
+	flag.DurationVar(&a.CleanupTimeout, "cleanupTimeout", time.Hour, "Remove cleanup finalizer of a deleted namespace after this time even if vault cleanup fails, 0 to wait forever")
 	flag.Parse()
 	a.Args = flag.Args()
 	return a
@@ -0,0 +1,108 @@
+package args
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultTarget is the name of the vault target configured by flags.
+const DefaultTarget = "default"
+
+// Target is a named vault target of -vaultTargets file, its fields are named after flags
+// and override them, unset fields are taken from flags.
+type Target struct {
+	Name               string `json:"name"`
+	VaultAddr          string `json:"vaultAddr"`
+	VaultToken         string `json:"vaultToken"`
+	Unwrap             *bool  `json:"unwrap"`
+	AuthMethod         string `json:"authMethod"`
+	AuthPath           string `json:"authPath"`
+	KubeTokenPath      string `json:"kubeTokenPath"`
+	RoleIDPath         string `json:"roleIdPath"`
+	SecretIDPath       string `json:"secretIdPath"`
+	SecretIDWrapped    *bool  `json:"secretIdWrapped"`
+	JWTPath            string `json:"jwtPath"`
+	VaultPolicyT       string `json:"vaultPolicyName"`
+	VaultSecretsPathT  string `json:"vaultSecretsPath"`
+	VaultAuthT         string `json:"vaultAuth"`
+	VaultNamespace     string `json:"vaultNamespace"`
+	VaultNamespaceT    string `json:"vaultNamespaceTemplate"`
+	VaultCACert        string `json:"vaultCACert"`
+	VaultCAPath        string `json:"vaultCAPath"`
+	VaultClientCert    string `json:"vaultClientCert"`
+	VaultClientKey     string `json:"vaultClientKey"`
+	VaultTLSServerName string `json:"vaultTLSServerName"`
+	VaultSkipVerify    *bool  `json:"vaultSkipVerify"`
+	GroupProviders     string `json:"groupProviders"`
+}
+
+func override(dst *string, value string) {
+	if len(value) > 0 {
+		*dst = value
+	}
+}
+
+func overrideBool(dst *bool, value *bool) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+// apply returns a copy of args with the target fields set.
+func (t *Target) apply(a *Args) *Args {
+	re := *a
+	override(&re.VaultAddr, t.VaultAddr)
+	override(&re.VaultToken, t.VaultToken)
+	overrideBool(&re.Unwrap, t.Unwrap)
+	override(&re.AuthMethod, t.AuthMethod)
+	override(&re.AuthPath, t.AuthPath)
+	override(&re.KubeTokenPath, t.KubeTokenPath)
+	override(&re.RoleIDPath, t.RoleIDPath)
+	override(&re.SecretIDPath, t.SecretIDPath)
+	overrideBool(&re.SecretIDWrapped, t.SecretIDWrapped)
+	override(&re.JWTPath, t.JWTPath)
+	override(&re.VaultPolicyT, t.VaultPolicyT)
+	override(&re.VaultSecretsPathT, t.VaultSecretsPathT)
+	override(&re.VaultAuthT, t.VaultAuthT)
+	override(&re.VaultNamespace, t.VaultNamespace)
+	override(&re.VaultNamespaceT, t.VaultNamespaceT)
+	override(&re.VaultCACert, t.VaultCACert)
+	override(&re.VaultCAPath, t.VaultCAPath)
+	override(&re.VaultClientCert, t.VaultClientCert)
+	override(&re.VaultClientKey, t.VaultClientKey)
+	override(&re.VaultTLSServerName, t.VaultTLSServerName)
+	overrideBool(&re.VaultSkipVerify, t.VaultSkipVerify)
+	override(&re.GroupProviders, t.GroupProviders)
+	return &re
+}
+
+// Targets returns args of vault targets by name, the default target is configured by flags
+// and the others by -vaultTargets YAML or JSON list of targets, a target named default overrides flags.
+func (a *Args) Targets() (map[string]*Args, error) {
+	targets := map[string]*Args{DefaultTarget: a}
+	if len(a.VaultTargets) == 0 {
+		return targets, nil
+	}
+	data, err := ioutil.ReadFile(a.VaultTargets)
+	if err != nil {
+		return nil, err
+	}
+	var list []Target
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("vault targets:%s error:%s", a.VaultTargets, err)
+	}
+	seen := make(map[string]bool)
+	for _, t := range list {
+		if len(t.Name) == 0 {
+			return nil, fmt.Errorf("vault target without name in:%s", a.VaultTargets)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("duplicate vault target:%s", t.Name)
+		}
+		seen[t.Name] = true
+		targets[t.Name] = t.apply(a)
+	}
+	return targets, nil
+}
@@ -0,0 +1,66 @@
+package args
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets string
+		addrs   map[string]string
+		unwrap  map[string]bool
+		valid   bool
+	}{
+		{"flags only", "", map[string]string{"default": "https://flags"}, map[string]bool{"default": true}, true},
+		{"yaml", "- name: eu\n  vaultAddr: https://eu\n  unwrap: false\n- name: us\n", map[string]string{"default": "https://flags", "eu": "https://eu", "us": "https://flags"}, map[string]bool{"default": true, "eu": false, "us": true}, true},
+		{"json", `[{"name": "eu", "vaultAddr": "https://eu"}]`, map[string]string{"default": "https://flags", "eu": "https://eu"}, map[string]bool{"default": true, "eu": true}, true},
+		{"default overrides flags", "- name: default\n  vaultAddr: https://default\n", map[string]string{"default": "https://default"}, map[string]bool{"default": true}, true},
+		{"no name", "- vaultAddr: https://eu\n", nil, nil, false},
+		{"duplicate", "- name: eu\n- name: eu\n", nil, nil, false},
+		{"unknown type", "- name: eu\n  unwrap: maybe\n", nil, nil, false},
+		{"not a list", "name: eu\n", nil, nil, false},
+	}
+	for _, test := range tests {
+		a := &Args{VaultAddr: "https://flags", Unwrap: true}
+		if len(test.targets) > 0 {
+			file, err := ioutil.TempFile("", "targets")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+			file.WriteString(test.targets)
+			file.Close()
+			a.VaultTargets = file.Name()
+		}
+		targets, err := a.Targets()
+		if a.VaultAddr != "https://flags" || !a.Unwrap {
+			t.Errorf("%s: targets changed flags", test.name)
+		}
+		if (err == nil) != test.valid {
+			t.Errorf("%s: valid:%v error:%v", test.name, test.valid, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(targets) != len(test.addrs) {
+			t.Errorf("%s: targets:%d want:%d", test.name, len(targets), len(test.addrs))
+		}
+		for name, addr := range test.addrs {
+			target, ok := targets[name]
+			if !ok {
+				t.Errorf("%s: no target:%s", test.name, name)
+				continue
+			}
+			if target.VaultAddr != addr || target.Unwrap != test.unwrap[name] {
+				t.Errorf("%s: target:%s addr:%s unwrap:%v, want addr:%s unwrap:%v", test.name, name, target.VaultAddr, target.Unwrap, addr, test.unwrap[name])
+			}
+		}
+	}
+	if _, err := (&Args{VaultTargets: "/nonexistent/targets.yaml"}).Targets(); err == nil {
+		t.Errorf("missing targets file is accepted")
+	}
+}
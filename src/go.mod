@@ -4,7 +4,9 @@ go 1.13
 
 require (
 	github.com/JoelSpeed/webhook-certificate-generator v0.1.1 // indirect
+	github.com/hashicorp/go-multierror v1.0.0
 	github.com/hashicorp/go-sockaddr v1.0.2
+	github.com/hashicorp/hcl v1.0.0
 	github.com/hashicorp/vault/api v1.0.4
 	github.com/sirupsen/logrus v1.4.2
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45 // indirect
@@ -14,4 +16,5 @@ require (
 	k8s.io/client-go v0.0.0-20191016110837-54936ba21026
 	k8s.io/klog v1.0.0
 	k8s.io/utils v0.0.0-20191114200735-6ca3b61696b6 // indirect
+	sigs.k8s.io/yaml v1.1.0
 )
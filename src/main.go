@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"vaultlink/app"
 )
 
@@ -14,5 +15,12 @@ var builtBy string
 func main() {
 	fmt.Printf("Vaultlink starting, version:%s commit:%s date:%s builtBy:%s\n", version, commit, date, builtBy)
 	app := app.New().Connect()
+	if cmd := app.Args().Args; len(cmd) > 0 && cmd[0] == "migrate-kv" {
+		if err := app.MigrateKV(cmd[1:]); err != nil {
+			fmt.Printf("Migration failed:%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	app.Control()
 }
@@ -6,21 +6,28 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"syscall"
+	"time"
 	"vaultlink/vault"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type Server struct {
-	server *http.Server
-	vault  *vault.Vault
+	server   *http.Server
+	vaults   map[string]*vault.Vault
+	isLeader func() bool
 }
 
-func New(vault *vault.Vault, port int) *Server {
-	srv := &Server{vault: vault, server: &http.Server{Addr: fmt.Sprintf(":%v", port)}}
+// New serves health of vault targets by name.
+func New(vaults map[string]*vault.Vault, port int) *Server {
+	srv := &Server{vaults: vaults, server: &http.Server{Addr: fmt.Sprintf(":%v", port)}}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", srv.Serve)
+	mux.HandleFunc("/leader", srv.ServeLeader)
+	mux.HandleFunc("/metrics", srv.ServeMetrics)
 	srv.server.Handler = mux
 	return srv
 }
@@ -43,10 +50,94 @@ func (srv *Server) Listen() {
 	srv.server.Shutdown(context.Background())
 }
 
+// SetLeader sets leadership check, without it the server is always the leader.
+func (srv *Server) SetLeader(isLeader func() bool) {
+	srv.isLeader = isLeader
+}
+
+func (srv *Server) leader() bool {
+	return srv.isLeader == nil || srv.isLeader()
+}
+
+func (srv *Server) targets() []string {
+	var names []string
+	for name := range srv.vaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ping returns the error of an unavailable vault target or of its ping.
+func ping(v *vault.Vault) error {
+	if err := v.Available(); err != nil {
+		return err
+	}
+	return v.Ping()
+}
+
+// Serve reports every vault target, it fails only if no target is available.
 func (srv *Server) Serve(w http.ResponseWriter, r *http.Request) {
-	if err := srv.vault.Ping(); err != nil {
-		log.Errorf("vault ping error:%s", err)
-		http.Error(w, fmt.Sprintf("vault ping error: %v", err), http.StatusInternalServerError)
+	var lines []string
+	available := 0
+	for _, name := range srv.targets() {
+		v := srv.vaults[name]
+		if err := ping(v); err != nil {
+			log.Errorf("vault target:%s ping error:%s", name, err)
+			lines = append(lines, fmt.Sprintf("target:%s error:%s", name, err))
+			continue
+		}
+		available++
+		lines = append(lines, fmt.Sprintf("target:%s ok token_expiry:%s", name, tokenExpiry(v)))
+	}
+	if available == 0 {
+		http.Error(w, fmt.Sprintf("vault ping error\n%s", strings.Join(lines, "\n")), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "ok\nleader:%t\n", srv.leader())
+	if v, ok := srv.vaults["default"]; ok {
+		fmt.Fprintf(w, "token_expiry:%s\n", tokenExpiry(v))
+	}
+	fmt.Fprintf(w, "%s\n", strings.Join(lines, "\n"))
+}
+
+func tokenExpiry(v *vault.Vault) string {
+	expiry := v.TokenExpiry()
+	if expiry.IsZero() {
+		return "never"
+	}
+	return expiry.Format(time.RFC3339)
+}
+
+// ServeMetrics exposes availability and token expiry of vault targets in prometheus text format,
+// expiry is 0 if the token does not expire.
+func (srv *Server) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP vaultlink_target_up Vault target is connected and logged in.\n")
+	fmt.Fprintf(w, "# TYPE vaultlink_target_up gauge\n")
+	for _, name := range srv.targets() {
+		up := 0
+		if srv.vaults[name].Available() == nil {
+			up = 1
+		}
+		fmt.Fprintf(w, "vaultlink_target_up{target=%q} %d\n", name, up)
+	}
+	fmt.Fprintf(w, "# HELP vaultlink_token_expiry_timestamp_seconds Expiry of the vault token.\n")
+	fmt.Fprintf(w, "# TYPE vaultlink_token_expiry_timestamp_seconds gauge\n")
+	for _, name := range srv.targets() {
+		var expiry int64
+		if t := srv.vaults[name].TokenExpiry(); !t.IsZero() {
+			expiry = t.Unix()
+		}
+		fmt.Fprintf(w, "vaultlink_token_expiry_timestamp_seconds{target=%q} %d\n", name, expiry)
+	}
+}
+
+// ServeLeader responds with 200 on the leader and with 503 on other replicas.
+func (srv *Server) ServeLeader(w http.ResponseWriter, r *http.Request) {
+	if !srv.leader() {
+		http.Error(w, "leader:false", http.StatusServiceUnavailable)
+		return
 	}
-	fmt.Fprintf(w, "ok")
+	fmt.Fprintf(w, "leader:true\n")
 }
@@ -3,7 +3,11 @@ package vault
 import (
 	"bytes"
 	"fmt"
+	"path"
+	"strings"
 
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
 )
@@ -12,6 +16,11 @@ type BindInfo struct {
 	Auth       string
 	Policy     string
 	Policypath string
+	Groups     []Group
+	// Namespace is the vault enterprise namespace of the binding, empty for the root namespace.
+	Namespace string
+	// Targets are names of vault targets of the spec.
+	Targets []string
 }
 
 type Tmpl struct {
@@ -38,133 +47,279 @@ func (v *Vault) makeSecretsPathName(cluster, namespace, sa string) string {
 	return buf.String()
 }
 
-func (v *Vault) makeOktaGroupPath(group string) string {
-	return fmt.Sprintf("auth/okta/groups/%s", group)
-}
-
-func (v *Vault) Unbind(cluster, namespace, sa, oktaGroup string) {
-	name := v.makeAuthName(cluster, namespace, sa)
+// unbind removes all vault resources of the namespace and group resources of it in gv, it does not
+// stop on the first failure and returns all errors it encountered.
+func (v *Vault) unbind(spec *BindSpec, gv *Vault) error {
+	var errs *multierror.Error
+	name := v.makeAuthName(spec.Cluster, spec.Namespace, spec.ServiceAccount)
 	log.Infof("Disabling auth path:%s", name)
 	err := v.api.Client().Sys().DisableAuth(name)
 	if err != nil {
 		log.Errorf("Disable auth:%s %s", name, err)
+		errs = multierror.Append(errs, stepError("auth", name, err))
 	}
-	policyName := v.makePolicyName(cluster, namespace, sa)
+	policyName := v.makePolicyName(spec.Cluster, spec.Namespace, spec.ServiceAccount)
 	log.Infof("Deleting policy name:%s", policyName)
 	err = v.api.Client().Sys().DeletePolicy(policyName)
 	if err != nil {
 		log.Errorf("Delete policy:%s error:%s", policyName, err)
+		errs = multierror.Append(errs, stepError("policy", policyName, err))
 	}
-	if len(oktaGroup) > 0 {
-		oktaGroupPath := v.makeOktaGroupPath(oktaGroup)
-		log.Infof("Delete okta group policy and identity mapping:%s", oktaGroupPath)
-		_, err = v.api.Client().Logical().Delete(oktaGroupPath)
-		if err != nil {
-			log.Errorf("Delete okta group policy:%s error:%s", oktaGroupPath, err)
+	groups := append(append([]Group{}, spec.Groups...), spec.BoundGroups...)
+	for groupPolicy := range gv.groupPolicies(v, spec, policyName, groups) {
+		log.Infof("Deleting policy name:%s", groupPolicy)
+		if err := gv.api.Client().Sys().DeletePolicy(groupPolicy); err != nil {
+			log.Errorf("Delete policy:%s error:%s", groupPolicy, err)
+			errs = multierror.Append(errs, stepError("policy", groupPolicy, err))
 		}
-		_, err = v.api.Client().Logical().Delete(fmt.Sprintf("identity/group/name/%s", oktaGroup))
-		if err != nil {
-			log.Errorf("Delete okta group identity:%s error:%s", oktaGroup, err)
+	}
+	for _, group := range groups {
+		if err := gv.unbindGroup(group.Name, spec.groupPolicy(policyName, group)); err != nil {
+			errs = multierror.Append(errs, err)
 		}
 	}
+	return errs.ErrorOrNil()
 }
 
-func (v *Vault) Bind(cluster, namespace, sa, kubeAddr, oktaGroup string, token, ca []byte) *BindInfo {
-	name := v.makeAuthName(cluster, namespace, sa)
-	log.Infof("Enabling auth path:%s", name)
-	err := v.api.Client().Sys().EnableAuthWithOptions(name, &api.EnableAuthOptions{Type: "kubernetes"})
-	if err != nil {
-		log.Errorf("Enable auth:%s error:%s", name, err)
+// groupPolicies returns names of policies of groups mapped to tiers, they are kept in gv, the vault
+// of auth mounts of groups. The namespace policy is written to gv too if it is not v.
+func (gv *Vault) groupPolicies(v *Vault, spec *BindSpec, policyName string, groups []Group) map[string]string {
+	re := spec.tierPolicies(policyName, groups)
+	if gv != v {
+		re[policyName] = ""
 	}
+	return re
+}
 
-	cfgPath := fmt.Sprintf("auth/%s/config", name)
-	log.Infof("Configuring auth method:%s", cfgPath)
-	_, err = v.api.Client().Logical().Write(cfgPath, VaultData{
-		"token_reviewer_jwt": string(token),
-		"kubernetes_host":    kubeAddr,
-		"kubernetes_ca_cert": string(ca),
-	})
-	if err != nil {
-		log.Errorf("Configure auth path:%s error:%s", cfgPath, err)
+// relativeNamespace returns the namespace of v relative to the namespace of gv, policies of gv
+// reach paths of v with it as prefix.
+func (gv *Vault) relativeNamespace(v *Vault) string {
+	if gv == v {
+		return ""
 	}
+	return strings.Trim(strings.TrimPrefix(v.namespace, gv.namespace), "/")
+}
 
-	rolePath := fmt.Sprintf("auth/%s/role/%s", name, sa)
-	policyName := v.makePolicyName(cluster, namespace, sa)
+// bind creates or repairs all vault resources of the namespace as a transaction, it stops on the first failure,
+// rolls back resources created by this call and returns the failure as *StepError.
+// Groups, their policies and mappings are kept in gv, that is v unless v is a child namespace.
+// Steps are added to tx after the steps of the caller.
+func (v *Vault) bind(spec *BindSpec, gv *Vault, tx *transaction) (*BindInfo, error) {
+	name := v.makeAuthName(spec.Cluster, spec.Namespace, spec.ServiceAccount)
+	cfgPath := fmt.Sprintf("auth/%s/config", name)
+	policyName := v.makePolicyName(spec.Cluster, spec.Namespace, spec.ServiceAccount)
+	secretsPath := v.makeSecretsPathName(spec.Cluster, spec.Namespace, spec.ServiceAccount)
+	// the default kv version only applies to new secrets paths, policies follow the mounted version,
+	// nothing is mounted yet if the caller creates the namespace of v
+	if spec.KVVersion == 0 && len(tx.steps) == 0 {
+		version, err := v.mountKVVersion(secretsPath)
+		if err != nil {
+			return nil, stepError("secrets", secretsPath, err)
+		}
+		if version != 0 {
+			mounted := *spec
+			mounted.KVVersion = version
+			spec = &mounted
+		}
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, stepError("validate", spec.Namespace, err)
+	}
+	policies := map[string]string{policyName: ""}
+	groupPolicies := gv.groupPolicies(v, spec, policyName, spec.Groups)
+	if gv == v {
+		for tierPolicy, tier := range groupPolicies {
+			policies[tierPolicy] = tier
+		}
+		groupPolicies = map[string]string{}
+	}
+	render := func(policies map[string]string, secretsPath string) error {
+		for name, tier := range policies {
+			body, err := v.policy(spec, secretsPath, tier)
+			if err != nil {
+				return stepError("policy-template", name, err)
+			}
+			policies[name] = fmt.Sprintf("# %s\n%s", marker(spec.Cluster), body)
+		}
+		return nil
+	}
+	if err := render(policies, secretsPath); err != nil {
+		return nil, err
+	}
+	if err := render(groupPolicies, path.Join(gv.relativeNamespace(v), secretsPath)); err != nil {
+		return nil, err
+	}
 
-	log.Infof("Configuring auth role:%s", rolePath)
-	_, err = v.api.Client().Logical().Write(rolePath, VaultData{
-		"bound_service_account_names":      sa,
-		"bound_service_account_namespaces": namespace,
-		"policies":                         policyName,
-		"token_num_uses":                   0,
-		"token_ttl":                        "24h",
+	tx.add("auth", name, func() (undo, error) {
+		return v.ensureAuth(name, &api.EnableAuthOptions{Type: "kubernetes", Description: marker(spec.Cluster)})
 	})
-	if err != nil {
-		log.Errorf("Configure auth role path:%s error:%s", rolePath, err)
+	tx.add("auth-config", cfgPath, func() (undo, error) {
+		return v.ensureData(cfgPath, spec.authConfig(), spec.RewriteConfig, spec.authConfigKeys()...)
+	})
+	for _, r := range spec.roles() {
+		rolePath := fmt.Sprintf("auth/%s/role/%s", name, r.ServiceAccount)
+		role := spec.roleData(r, policyName)
+		tx.add("role", rolePath, func() (undo, error) {
+			return v.ensureData(rolePath, role, false, keys(role)...)
+		})
 	}
-
-	secretsPath := v.makeSecretsPathName(cluster, namespace, sa)
-	log.Infof("Configuring policy:%s secrets path:%s", policyName, secretsPath)
-	policy := fmt.Sprintf(`path "%s/*" {
-capabilities = ["create", "read", "update", "delete", "list"]
-}`, secretsPath)
-	err = v.api.Client().Sys().PutPolicy(policyName, policy)
-	if err != nil {
-		log.Errorf("Configuring policy:%s path:%s error:%s", policyName, secretsPath, err)
+	// secrets path is checked before the policy, so a policy for another kv version is not written
+	tx.add("secrets", secretsPath, func() (undo, error) {
+		return v.ensureMount(secretsPath, &api.MountInput{
+			Type:        "kv",
+			Description: marker(spec.Cluster),
+			Options:     map[string]string{"version": fmt.Sprint(spec.kvVersion())},
+		})
+	})
+	if spec.kvVersion() == 2 {
+		kvCfgPath := secretsPath + "/config"
+		kvCfg := spec.kvConfig()
+		tx.add("secrets-config", kvCfgPath, func() (undo, error) {
+			return v.ensureData(kvCfgPath, kvCfg, false, keys(kvCfg)...)
+		})
 	}
-
-	oktaGroupPath := v.makeOktaGroupPath(oktaGroup)
-	log.Infof("Configuring okta group mapping, group:%s, policy:%s", oktaGroupPath, policyName)
-	_, err = v.api.Client().Logical().Write(oktaGroupPath, VaultData{
-		"policies": []string{policyName},
+	for name, policy := range policies {
+		policyName, policy := name, policy
+		tx.add("policy", policyName, func() (undo, error) {
+			return v.ensurePolicy(policyName, policy)
+		})
+	}
+	for name, policy := range groupPolicies {
+		policyName, policy := name, policy
+		tx.add("group-policy", path.Join(gv.namespace, policyName), func() (undo, error) {
+			return gv.ensurePolicy(policyName, policy)
+		})
+	}
+	for _, g := range spec.Groups {
+		group, groupPolicy := g.Name, spec.groupPolicy(policyName, g)
+		var groupID string
+		if gv.identityGroups() {
+			groupPath := fmt.Sprintf("identity/group/name/%s", group)
+			tx.add("identity-group", groupPath, func() (undo, error) {
+				var u undo
+				var err error
+				groupID, u, err = gv.ensureIdentityGroup(group, groupPolicy)
+				return u, err
+			})
+		}
+		for _, p := range gv.groupProviders {
+			provider := p
+			tx.add("group", provider.String()+"/"+group, func() (undo, error) {
+				return provider.ensure(gv, group, groupID, groupPolicy)
+			})
+		}
+	}
+	// stale roles and groups can't be restored on rollback, so they are pruned last
+	tx.add("roles-prune", fmt.Sprintf("auth/%s/role", name), func() (undo, error) {
+		return nil, v.pruneRoles(name, spec.RoleServiceAccounts())
 	})
-	if err != nil {
-		log.Errorf("Configure auth role path:%s error:%s", rolePath, err)
+	tx.add("groups-prune", policyName, func() (undo, error) {
+		if gv == v {
+			return nil, gv.pruneGroups(spec, policyName, policies)
+		}
+		return nil, gv.pruneGroups(spec, policyName, groupPolicies)
+	})
+	if err := tx.run(); err != nil {
+		return nil, err
 	}
+	return &BindInfo{name, policyName, secretsPath, spec.Groups, v.namespace, spec.Targets}, nil
+}
 
-	v.configureAlias(oktaGroup, policyName)
+// pruneGroups unmaps bound groups that are no longer in spec or changed tier, and deletes unused tier policies.
+func (v *Vault) pruneGroups(spec *BindSpec, policyName string, policies map[string]string) error {
+	want := make(map[[2]string]bool)
+	for _, group := range spec.Groups {
+		want[[2]string{group.Name, spec.groupPolicy(policyName, group)}] = true
+	}
+	for _, group := range spec.BoundGroups {
+		groupPolicy := spec.groupPolicy(policyName, group)
+		if want[[2]string{group.Name, groupPolicy}] {
+			continue
+		}
+		log.Infof("Unmapping stale group:%s policy:%s", group.Name, groupPolicy)
+		if err := v.unbindGroup(group.Name, groupPolicy); err != nil {
+			return err
+		}
+	}
+	for tierPolicy := range spec.tierPolicies(policyName, spec.BoundGroups) {
+		if _, ok := policies[tierPolicy]; ok {
+			continue
+		}
+		log.Infof("Deleting stale policy:%s", tierPolicy)
+		if err := v.api.Client().Sys().DeletePolicy(tierPolicy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	err = v.api.Client().Sys().Mount(secretsPath, &api.MountInput{Type: "kv"})
-	if err != nil {
-		log.Warnf("Can't mount secrets engine for path:%s, error:%s", secretsPath, err)
+// unbindGroup removes policy from the group mappings of all providers and from the identity group.
+func (v *Vault) unbindGroup(group, policyName string) error {
+	var errs *multierror.Error
+	for _, provider := range v.groupProviders {
+		log.Infof("Delete group:%s policy:%s mapping of provider:%s", group, policyName, provider)
+		if err := provider.remove(v, group, policyName); err != nil {
+			log.Errorf("Delete group:%s mapping of provider:%s error:%s", group, provider, err)
+			errs = multierror.Append(errs, stepError("group", provider.String()+"/"+group, err))
+		}
 	}
+	if v.identityGroups() {
+		groupPath := fmt.Sprintf("identity/group/name/%s", group)
+		if err := v.removeIdentityGroupPolicy(group, policyName); err != nil {
+			log.Errorf("Delete group identity:%s error:%s", group, err)
+			errs = multierror.Append(errs, stepError("identity-group", groupPath, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
 
-	return &BindInfo{name, policyName, secretsPath}
+// pruneRoles deletes roles of the auth mount that are not in the list.
+func (v *Vault) pruneRoles(name string, roles []string) error {
+	re, err := v.api.Client().Logical().List(fmt.Sprintf("auth/%s/role", name))
+	if err != nil || re == nil || re.Data == nil {
+		return err
+	}
+	want := make(map[string]bool)
+	for _, role := range roles {
+		want[role] = true
+	}
+	for _, role := range toStrings(re.Data["keys"]) {
+		if want[role] {
+			continue
+		}
+		rolePath := fmt.Sprintf("auth/%s/role/%s", name, role)
+		log.Infof("Deleting stale role:%s", rolePath)
+		if _, err := v.api.Client().Logical().Delete(rolePath); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (v *Vault) configureAlias(oktaGroup, policyName string) {
-	log.Infof("Configuring okta group alias:%s", oktaGroup)
-	group, err := v.api.Client().Logical().Write("identity/group", VaultData{
-		"name":     oktaGroup,
-		"type":     "external",
-		"policies": []string{policyName},
-	})
-	if err != nil {
-		log.Errorf("Can't write identity group:%s error:%s", oktaGroup, err)
-		return
+// policy renders the namespace policy from spec rules or the policy tier, or the policy of a group tier.
+func (v *Vault) policy(spec *BindSpec, secretsPath, tier string) (string, error) {
+	if len(tier) == 0 && len(spec.Rules) > 0 {
+		body := spec.rulesPolicy(secretsPath)
+		if _, err := hcl.Parse(body); err != nil {
+			return "", fmt.Errorf("invalid hcl:%s", err)
+		}
+		return body, nil
 	}
-	id, ok := group.Data["id"].(string)
-	if !ok {
-		log.Errorf("Can't get okta group id, data:%s, id:%s", group.Data, id)
-		return
+	if len(tier) == 0 {
+		tier = spec.policyTier()
 	}
-	auth, err := v.api.Client().Sys().ListAuth()
-	if err != nil {
-		log.Errorf("Can't get auth list, error:%s", err)
-		return
-	}
-	oidc, ok := auth["oidc/"]
-	if !ok {
-		log.Errorf("No OIDC accessor, error:%s", err)
-		return
-	}
-	_, err = v.api.Client().Logical().Write("identity/group-alias", VaultData{
-		"name":           oktaGroup,
-		"mount_accessor": oidc.Accessor,
-		"canonical_id":   id,
+	return v.policies.Render(tier, PolicyData{
+		Tmpl:        Tmpl{spec.Cluster, spec.Namespace, spec.ServiceAccount},
+		SecretsPath: secretsPath,
+		KVVersion:   spec.kvVersion(),
+		Labels:      spec.Labels,
 	})
-	if err != nil {
-		log.Errorf("Can't write group alias name:%s, accessor:%s, id:%s, error:%s", oktaGroup, oidc.Accessor, id, err)
-		return
+}
+
+func keys(data VaultData) []string {
+	var re []string
+	for key := range data {
+		re = append(re, key)
 	}
+	return re
 }
@@ -0,0 +1,249 @@
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// normalize turns values written to and read from vault into comparable strings,
+// vault returns numbers as json.Number and string lists as []interface{}.
+func normalize(value interface{}) string {
+	var items []string
+	switch v := value.(type) {
+	case []string:
+		items = append(items, v...)
+	case []interface{}:
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// drift returns keys of want that are missing or different in got.
+func drift(want, got VaultData) []string {
+	var keys []string
+	for key, value := range want {
+		if current, ok := got[key]; !ok || normalize(current) != normalize(value) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list interface{}, item string) bool {
+	switch v := list.(type) {
+	case []string:
+		for _, s := range v {
+			if s == item {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, s := range v {
+			if fmt.Sprint(s) == item {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toStrings(list interface{}) []string {
+	var re []string
+	switch v := list.(type) {
+	case []string:
+		re = append(re, v...)
+	case []interface{}:
+		for _, s := range v {
+			re = append(re, fmt.Sprint(s))
+		}
+	}
+	return re
+}
+
+// ensureData writes data to path unless vault already has the same values for compare keys,
+// with force it is written anyway, for values vault does not return like secrets.
+func (v *Vault) ensureData(path string, data VaultData, force bool, compare ...string) (undo, error) {
+	re, err := v.api.Client().Logical().Read(path)
+	if err != nil {
+		return nil, err
+	}
+	want := make(VaultData)
+	for _, key := range compare {
+		want[key] = data[key]
+	}
+	if re != nil && re.Data != nil {
+		keys := drift(want, re.Data)
+		if len(keys) == 0 && !force {
+			log.Debugf("Path:%s is in sync", path)
+			return nil, nil
+		}
+		if len(keys) == 0 {
+			log.Infof("Rewriting path:%s", path)
+		} else {
+			log.Infof("Repairing path:%s, drifted keys:%s", path, keys)
+		}
+		_, err = v.api.Client().Logical().Write(path, data)
+		return nil, err
+	}
+	log.Infof("Writing path:%s", path)
+	if _, err = v.api.Client().Logical().Write(path, data); err != nil {
+		return nil, err
+	}
+	return v.deletePath(path), nil
+}
+
+// ensureAuth enables auth method at path unless it is already mounted.
+func (v *Vault) ensureAuth(path string, input *api.EnableAuthOptions) (undo, error) {
+	auths, err := v.api.Client().Sys().ListAuth()
+	if err != nil {
+		return nil, err
+	}
+	if auth, ok := auths[path+"/"]; ok {
+		if auth.Type != input.Type {
+			return nil, fmt.Errorf("auth path:%s has type:%s, expected:%s", path, auth.Type, input.Type)
+		}
+		if auth.Description != input.Description {
+			log.Infof("Repairing auth path:%s description", path)
+			return nil, v.api.Client().Sys().TuneMount("auth/"+path, api.MountConfigInput{Description: &input.Description})
+		}
+		log.Debugf("Auth path:%s is in sync", path)
+		return nil, nil
+	}
+	log.Infof("Enabling auth path:%s", path)
+	if err = v.api.Client().Sys().EnableAuthWithOptions(path, input); err != nil {
+		return nil, err
+	}
+	return func() error { return v.api.Client().Sys().DisableAuth(path) }, nil
+}
+
+// ensureMount mounts secrets engine at path unless it is already mounted.
+func (v *Vault) ensureMount(path string, input *api.MountInput) (undo, error) {
+	mounts, err := v.api.Client().Sys().ListMounts()
+	if err != nil {
+		return nil, err
+	}
+	if mount, ok := mounts[path+"/"]; ok {
+		if mount.Type != input.Type {
+			return nil, fmt.Errorf("secrets path:%s has type:%s, expected:%s", path, mount.Type, input.Type)
+		}
+		if kvVersion(mount.Options) != kvVersion(input.Options) {
+			return nil, fmt.Errorf("secrets path:%s has kv version:%s, expected:%s", path, kvVersion(mount.Options), kvVersion(input.Options))
+		}
+		if mount.Description != input.Description {
+			log.Infof("Repairing secrets path:%s description", path)
+			return nil, v.api.Client().Sys().TuneMount(path, api.MountConfigInput{Description: &input.Description})
+		}
+		log.Debugf("Secrets path:%s is in sync", path)
+		return nil, nil
+	}
+	log.Infof("Mounting secrets engine path:%s", path)
+	if err = v.api.Client().Sys().Mount(path, input); err != nil {
+		return nil, err
+	}
+	return func() error { return v.api.Client().Sys().Unmount(path) }, nil
+}
+
+// mountKVVersion returns kv version of the kv secrets engine at path, 0 if none is mounted there.
+func (v *Vault) mountKVVersion(path string) (int, error) {
+	mounts, err := v.api.Client().Sys().ListMounts()
+	if err != nil {
+		return 0, err
+	}
+	mount, ok := mounts[path+"/"]
+	if !ok || mount.Type != "kv" {
+		return 0, nil
+	}
+	return strconv.Atoi(kvVersion(mount.Options))
+}
+
+// kvVersion returns kv version of mount options, mounts without version are version 1.
+func kvVersion(options map[string]string) string {
+	if version := options["version"]; len(version) > 0 {
+		return version
+	}
+	return "1"
+}
+
+// ensurePolicy writes policy unless vault already has the same policy body.
+func (v *Vault) ensurePolicy(name, policy string) (undo, error) {
+	current, err := v.api.Client().Sys().GetPolicy(name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(current) == strings.TrimSpace(policy) {
+		log.Debugf("Policy:%s is in sync", name)
+		return nil, nil
+	}
+	if len(current) > 0 {
+		log.Infof("Repairing policy:%s", name)
+		return nil, v.api.Client().Sys().PutPolicy(name, policy)
+	}
+	log.Infof("Writing policy:%s", name)
+	if err = v.api.Client().Sys().PutPolicy(name, policy); err != nil {
+		return nil, err
+	}
+	return func() error { return v.api.Client().Sys().DeletePolicy(name) }, nil
+}
+
+// ensurePolicies adds policy to the policies list stored at path.
+func (v *Vault) ensurePolicies(path, policyName string) (undo, error) {
+	re, err := v.api.Client().Logical().Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if re == nil || re.Data == nil {
+		log.Infof("Writing path:%s", path)
+		if _, err = v.api.Client().Logical().Write(path, VaultData{"policies": []string{policyName}}); err != nil {
+			return nil, err
+		}
+		return v.deletePath(path), nil
+	}
+	if contains(re.Data["policies"], policyName) {
+		log.Debugf("Path:%s is in sync", path)
+		return nil, nil
+	}
+	policies := toStrings(re.Data["policies"])
+	log.Infof("Repairing path:%s, adding policy:%s", path, policyName)
+	if _, err = v.api.Client().Logical().Write(path, VaultData{"policies": append(policies, policyName)}); err != nil {
+		return nil, err
+	}
+	return v.writePath(path, VaultData{"policies": policies}), nil
+}
+
+func without(list []string, item string) []string {
+	var re []string
+	for _, s := range list {
+		if s != item {
+			re = append(re, s)
+		}
+	}
+	return re
+}
+
+// removePolicies removes policy from the policies list stored at path, and deletes path if no policies are left.
+func (v *Vault) removePolicies(path, policyName string) error {
+	re, err := v.api.Client().Logical().Read(path)
+	if err != nil || re == nil || re.Data == nil || !contains(re.Data["policies"], policyName) {
+		return err
+	}
+	policies := without(toStrings(re.Data["policies"]), policyName)
+	if len(policies) == 0 {
+		log.Infof("Deleting path:%s", path)
+		_, err = v.api.Client().Logical().Delete(path)
+		return err
+	}
+	log.Infof("Writing path:%s, removing policy:%s", path, policyName)
+	_, err = v.api.Client().Logical().Write(path, VaultData{"policies": policies})
+	return err
+}
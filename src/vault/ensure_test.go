@@ -0,0 +1,31 @@
+package vault
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDrift(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  VaultData
+		got   VaultData
+		drift []string
+	}{
+		{"json number", VaultData{"token_ttl": 3600}, VaultData{"token_ttl": json.Number("3600")}, nil},
+		{"list order", VaultData{"policies": []string{"a", "b"}}, VaultData{"policies": []interface{}{"b", "a"}}, nil},
+		{"empty list", VaultData{"token_bound_cidrs": []string{}}, VaultData{"token_bound_cidrs": []interface{}{}}, nil},
+		{"bool", VaultData{"disable_local_ca_jwt": true}, VaultData{"disable_local_ca_jwt": true}, nil},
+		{"trailing newline", VaultData{"kubernetes_ca_cert": "cert"}, VaultData{"kubernetes_ca_cert": "cert\n"}, nil},
+		{"extra key", VaultData{"token_ttl": 60}, VaultData{"token_ttl": json.Number("60"), "period": 0}, nil},
+		{"missing key", VaultData{"token_ttl": 60, "token_max_ttl": 0}, VaultData{"token_ttl": json.Number("60")}, []string{"token_max_ttl"}},
+		{"changed value", VaultData{"kubernetes_host": "https://a", "token_ttl": 60}, VaultData{"kubernetes_host": "https://b", "token_ttl": json.Number("120")}, []string{"kubernetes_host", "token_ttl"}},
+		{"changed list", VaultData{"policies": []string{"a", "b"}}, VaultData{"policies": []interface{}{"a"}}, []string{"policies"}},
+	}
+	for _, test := range tests {
+		if keys := drift(test.want, test.got); !reflect.DeepEqual(keys, test.drift) {
+			t.Errorf("%s: drift:%v want:%v", test.name, keys, test.drift)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// StepError tells which bind or unbind step failed, on which vault path, and with which vault status code.
+type StepError struct {
+	Step   string
+	Path   string
+	Status int
+	Err    error
+}
+
+func (e *StepError) Error() string {
+	if e.Status > 0 {
+		return fmt.Sprintf("step:%s path:%s status:%d error:%s", e.Step, e.Path, e.Status, e.Err)
+	}
+	return fmt.Sprintf("step:%s path:%s error:%s", e.Step, e.Path, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+func stepError(step, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		return err
+	}
+	re := &StepError{Step: step, Path: path, Err: err}
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		re.Status = respErr.StatusCode
+	}
+	return re
+}
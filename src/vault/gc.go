@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// namespacePlaceholder stands in for the namespace when turning name templates into regexps.
+const namespacePlaceholder = "vaultlinknamespaceplaceholder"
+
+type Orphan struct {
+	Kind      string
+	Name      string
+	Namespace string
+}
+
+func (o Orphan) String() string {
+	return fmt.Sprintf("%s:%s namespace:%s", o.Kind, o.Name, o.Namespace)
+}
+
+// marker tags vault resources created by vaultlink for the cluster,
+// it is stored in mount descriptions and as the first policy line.
+func marker(cluster string) string {
+	return fmt.Sprintf("vaultlink:%s", cluster)
+}
+
+func isOwnedPolicy(policy, cluster string) bool {
+	return strings.HasPrefix(strings.TrimSpace(policy), "# "+marker(cluster)+"\n")
+}
+
+// nameRegexp matches names rendered by template for the cluster and captures the namespace.
+func nameRegexp(tmpl *template.Template, cluster, sa string) (*regexp.Regexp, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Tmpl{cluster, namespacePlaceholder, sa}); err != nil {
+		return nil, err
+	}
+	re := regexp.QuoteMeta(buf.String())
+	re = strings.Replace(re, namespacePlaceholder, "([a-z0-9]([-a-z0-9]*[a-z0-9])?)", 1)
+	return regexp.Compile("^" + re + "$")
+}
+
+func matchNamespace(re *regexp.Regexp, name string) (string, bool) {
+	m := re.FindStringSubmatch(name)
+	if len(m) < 2 {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Orphans lists vaultlink owned auth mounts and policies of the cluster whose namespace is not alive.
+func (v *Vault) Orphans(cluster, sa string, alive func(namespace string) bool) ([]Orphan, error) {
+	var orphans []Orphan
+	authRe, err := nameRegexp(v.authTmpl, cluster, sa)
+	if err != nil {
+		return nil, err
+	}
+	auths, err := v.api.Client().Sys().ListAuth()
+	if err != nil {
+		return nil, err
+	}
+	for path, auth := range auths {
+		name := strings.TrimSuffix(path, "/")
+		namespace, ok := matchNamespace(authRe, name)
+		if !ok || auth.Description != marker(cluster) || alive(namespace) {
+			continue
+		}
+		orphans = append(orphans, Orphan{"auth", name, namespace})
+	}
+	policyRe, err := nameRegexp(v.policyTmpl, cluster, sa)
+	if err != nil {
+		return nil, err
+	}
+	// group tier policies are named policy/tier
+	policyRe = regexp.MustCompile(strings.TrimSuffix(policyRe.String(), "$") + "(/[-a-z0-9]+)?$")
+	policies, err := v.api.Client().Sys().ListPolicies()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range policies {
+		namespace, ok := matchNamespace(policyRe, name)
+		if !ok || alive(namespace) {
+			continue
+		}
+		policy, err := v.api.Client().Sys().GetPolicy(name)
+		if err != nil {
+			log.Errorf("Get policy:%s error:%s", name, err)
+			continue
+		}
+		if !isOwnedPolicy(policy, cluster) {
+			log.Debugf("Skip foreign policy:%s", name)
+			continue
+		}
+		orphans = append(orphans, Orphan{"policy", name, namespace})
+	}
+	return orphans, nil
+}
+
+func (v *Vault) DeleteOrphan(o Orphan) error {
+	switch o.Kind {
+	case "auth":
+		return v.api.Client().Sys().DisableAuth(o.Name)
+	case "policy":
+		return v.api.Client().Sys().DeletePolicy(o.Name)
+	}
+	return fmt.Errorf("unknown orphan kind:%s", o.Kind)
+}
@@ -0,0 +1,112 @@
+package vault
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// testVault returns vault with a client of a server that answers GET and LIST requests of paths with data,
+// the server must be closed by the caller.
+func testVault(t *testing.T, policyTmpl, authTmpl string, data map[string]interface{}) (*Vault, *httptest.Server) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := data[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": body})
+	}))
+	config := api.DefaultConfig()
+	config.Address = srv.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("test")
+	v := New(srv.URL, policyTmpl, "k8s/{{ .Cluster }}/{{ .Namespace }}", authTmpl)
+	v.api.SetClient(client)
+	return v, srv
+}
+
+func TestNameRegexp(t *testing.T) {
+	tests := []struct {
+		tmpl      string
+		cluster   string
+		sa        string
+		name      string
+		namespace string
+		match     bool
+	}{
+		{"k8s/{{ .Cluster }}/{{ .Namespace }}", "prod.eu", "default", "k8s/prod.eu/app", "app", true},
+		{"k8s/{{ .Cluster }}/{{ .Namespace }}", "prod.eu", "default", "k8s/prodxeu/app", "", false},
+		{"k8s/{{ .Cluster }}/{{ .Namespace }}", "prod.eu", "default", "k8s/prod.eu/app/extra", "", false},
+		{"k8s/{{ .Cluster }}/{{ .Namespace }}", "prod.eu", "default", "k8s/prod.eu/App", "", false},
+		{"k8s/{{ .Cluster }}/{{ .Namespace }}", "prod.eu", "default", "k8s/other/app", "", false},
+		{"{{ .Cluster }}-{{ .Namespace }}-{{ .ServiceAccount }}", "c1", "vault-auth", "c1-my-app-vault-auth", "my-app", true},
+		{"{{ .Cluster }}-{{ .Namespace }}-{{ .ServiceAccount }}", "c1", "vault-auth", "c1-my-app-default", "", false},
+		{"{{ .Cluster }}-{{ .Namespace }}-{{ .ServiceAccount }}", "c1", "vault-auth", "c1--vault-auth", "", false},
+	}
+	for _, test := range tests {
+		re, err := nameRegexp(template.Must(template.New("name").Parse(test.tmpl)), test.cluster, test.sa)
+		if err != nil {
+			t.Fatalf("template:%s error:%s", test.tmpl, err)
+		}
+		namespace, ok := matchNamespace(re, test.name)
+		if ok != test.match || namespace != test.namespace {
+			t.Errorf("template:%s name:%s namespace:%q match:%v, want namespace:%q match:%v", test.tmpl, test.name, namespace, ok, test.namespace, test.match)
+		}
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	owned := map[string]interface{}{"policy": "# vaultlink:c1\npath \"x/*\" {}"}
+	v, srv := testVault(t, "k8s/{{ .Cluster }}/{{ .Namespace }}/{{ .ServiceAccount }}", "k8s-{{ .Cluster }}-{{ .Namespace }}", map[string]interface{}{
+		"/v1/sys/auth": map[string]interface{}{
+			"k8s-c1-dead/":    map[string]interface{}{"type": "kubernetes", "description": "vaultlink:c1"},
+			"k8s-c1-live/":    map[string]interface{}{"type": "kubernetes", "description": "vaultlink:c1"},
+			"k8s-c1-foreign/": map[string]interface{}{"type": "kubernetes", "description": "manual"},
+			"token/":          map[string]interface{}{"type": "token"},
+		},
+		"/v1/sys/policies/acl": map[string]interface{}{"keys": []string{
+			"default",
+			"k8s/c1/dead/vault-auth",
+			"k8s/c1/dead/vault-auth/read-only",
+			"k8s/c1/dead/other",
+			"k8s/c1/live/vault-auth",
+			"k8s/c1/manual/vault-auth",
+			"k8s/c2/dead/vault-auth",
+		}},
+		"/v1/sys/policies/acl/k8s/c1/dead/vault-auth":           owned,
+		"/v1/sys/policies/acl/k8s/c1/dead/vault-auth/read-only": owned,
+		"/v1/sys/policies/acl/k8s/c1/dead/other":                owned,
+		"/v1/sys/policies/acl/k8s/c1/live/vault-auth":           owned,
+		"/v1/sys/policies/acl/k8s/c1/manual/vault-auth":         map[string]interface{}{"policy": "path \"x/*\" {}"},
+		"/v1/sys/policies/acl/k8s/c2/dead/vault-auth":           owned,
+	})
+	defer srv.Close()
+	orphans, err := v.Orphans("c1", "vault-auth", func(namespace string) bool { return namespace == "live" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range orphans {
+		got = append(got, o.String())
+	}
+	sort.Strings(got)
+	want := []string{
+		"auth:k8s-c1-dead namespace:dead",
+		"policy:k8s/c1/dead/vault-auth namespace:dead",
+		"policy:k8s/c1/dead/vault-auth/read-only namespace:dead",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("orphans:%v want:%v", got, want)
+	}
+}
@@ -0,0 +1,223 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Group maps an external group to the namespace policy of a tier.
+type Group struct {
+	Name string
+	// Tier is the policy tier of the group, the namespace policy tier if empty.
+	Tier string
+}
+
+func (g Group) String() string {
+	if len(g.Tier) == 0 {
+		return g.Name
+	}
+	return g.Name + ":" + g.Tier
+}
+
+// ParseGroups parses comma separated group:tier list, e.g. "dev: read-only, sre: admin",
+// the tier may be omitted.
+func ParseGroups(value string) ([]Group, error) {
+	var groups []Group
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) == 0 {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 2)
+		group := Group{Name: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			group.Tier = strings.TrimSpace(parts[1])
+		}
+		if len(group.Name) == 0 {
+			return nil, fmt.Errorf("group without name:%s", item)
+		}
+		if seen[group.Name] {
+			return nil, fmt.Errorf("duplicate group:%s", group.Name)
+		}
+		seen[group.Name] = true
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// FormatGroups is the reverse of ParseGroups.
+func FormatGroups(groups []Group) string {
+	var re []string
+	for _, group := range groups {
+		re = append(re, group.String())
+	}
+	return strings.Join(re, ",")
+}
+
+// GroupProvider maps external groups of an auth method to namespace policies.
+type GroupProvider interface {
+	// String returns type:mount of the provider.
+	String() string
+	// identity tells the provider maps groups with an identity group alias.
+	identity() bool
+	ensure(v *Vault, group, groupID, policyName string) (undo, error)
+	// remove unmaps policy from the group and deletes the group mapping without policies.
+	remove(v *Vault, group, policyName string) error
+}
+
+// ParseGroupProviders parses comma separated type:mount list, the mount is the type if omitted.
+// Supported types are okta, ldap, github, oidc and jwt.
+func ParseGroupProviders(value string) ([]GroupProvider, error) {
+	var providers []GroupProvider
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 2)
+		kind, mount := parts[0], parts[0]
+		if len(parts) == 2 && len(parts[1]) > 0 {
+			mount = strings.Trim(parts[1], "/")
+		}
+		switch kind {
+		case "okta", "ldap":
+			providers = append(providers, &mountGroups{kind, mount})
+		case "github":
+			providers = append(providers, &githubTeams{mount})
+		case "oidc", "jwt":
+			providers = append(providers, &groupAlias{kind, mount})
+		default:
+			return nil, fmt.Errorf("unknown group provider:%s", kind)
+		}
+	}
+	aliases := 0
+	for _, p := range providers {
+		if p.identity() {
+			aliases++
+		}
+	}
+	if aliases > 1 {
+		return nil, fmt.Errorf("identity group can have one alias, got %d oidc and jwt providers", aliases)
+	}
+	return providers, nil
+}
+
+// mountGroups keeps group policies in auth/<mount>/groups/<group>, as okta and ldap do.
+type mountGroups struct {
+	kind  string
+	mount string
+}
+
+func (p *mountGroups) String() string {
+	return p.kind + ":" + p.mount
+}
+
+func (p *mountGroups) identity() bool {
+	return false
+}
+
+func (p *mountGroups) path(group string) string {
+	return fmt.Sprintf("auth/%s/groups/%s", p.mount, group)
+}
+
+func (p *mountGroups) ensure(v *Vault, group, groupID, policyName string) (undo, error) {
+	defer v.groups.lock(p.path(group))()
+	return v.ensurePolicies(p.path(group), policyName)
+}
+
+func (p *mountGroups) remove(v *Vault, group, policyName string) error {
+	defer v.groups.lock(p.path(group))()
+	return v.removePolicies(p.path(group), policyName)
+}
+
+// githubTeams keeps team policies as comma separated value of auth/<mount>/map/teams/<team>.
+type githubTeams struct {
+	mount string
+}
+
+func (p *githubTeams) String() string {
+	return "github:" + p.mount
+}
+
+func (p *githubTeams) identity() bool {
+	return false
+}
+
+func (p *githubTeams) path(team string) string {
+	return fmt.Sprintf("auth/%s/map/teams/%s", p.mount, team)
+}
+
+func (p *githubTeams) policies(v *Vault, path string) ([]string, error) {
+	re, err := v.api.Client().Logical().Read(path)
+	if err != nil || re == nil || re.Data == nil {
+		return nil, err
+	}
+	if value, ok := re.Data["value"].(string); ok && len(value) > 0 {
+		return strings.Split(value, ","), nil
+	}
+	return nil, nil
+}
+
+func (p *githubTeams) ensure(v *Vault, team, groupID, policyName string) (undo, error) {
+	path := p.path(team)
+	defer v.groups.lock(path)()
+	policies, err := p.policies(v, path)
+	if err != nil {
+		return nil, err
+	}
+	if contains(policies, policyName) {
+		log.Debugf("Path:%s is in sync", path)
+		return nil, nil
+	}
+	log.Infof("Writing path:%s, adding policy:%s", path, policyName)
+	if _, err = v.api.Client().Logical().Write(path, VaultData{"value": strings.Join(append(policies, policyName), ",")}); err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return v.deletePath(path), nil
+	}
+	return v.writePath(path, VaultData{"value": strings.Join(policies, ",")}), nil
+}
+
+func (p *githubTeams) remove(v *Vault, team, policyName string) error {
+	path := p.path(team)
+	defer v.groups.lock(path)()
+	policies, err := p.policies(v, path)
+	if err != nil || !contains(policies, policyName) {
+		return err
+	}
+	policies = without(policies, policyName)
+	if len(policies) == 0 {
+		log.Infof("Deleting path:%s", path)
+		_, err = v.api.Client().Logical().Delete(path)
+		return err
+	}
+	log.Infof("Writing path:%s, removing policy:%s", path, policyName)
+	_, err = v.api.Client().Logical().Write(path, VaultData{"value": strings.Join(policies, ",")})
+	return err
+}
+
+// groupAlias maps the external identity group to a group claim of an oidc or jwt mount.
+type groupAlias struct {
+	kind  string
+	mount string
+}
+
+func (p *groupAlias) String() string {
+	return p.kind + ":" + p.mount
+}
+
+func (p *groupAlias) identity() bool {
+	return true
+}
+
+func (p *groupAlias) ensure(v *Vault, group, groupID, policyName string) (undo, error) {
+	return v.ensureGroupAlias(p.mount, group, groupID)
+}
+
+// remove does nothing, aliases are removed with the identity group.
+func (p *groupAlias) remove(v *Vault, group, policyName string) error {
+	return nil
+}
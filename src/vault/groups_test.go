@@ -0,0 +1,60 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGroups(t *testing.T) {
+	tests := []struct {
+		value  string
+		groups []Group
+		valid  bool
+	}{
+		{"", nil, true},
+		{"dev", []Group{{Name: "dev"}}, true},
+		{"dev: read-only, sre: admin", []Group{{"dev", "read-only"}, {"sre", "admin"}}, true},
+		{" dev , ,sre:admin,", []Group{{Name: "dev"}, {"sre", "admin"}}, true},
+		{"dev:", []Group{{Name: "dev"}}, true},
+		{":admin", nil, false},
+		{"dev:read-only,dev:admin", nil, false},
+	}
+	for _, test := range tests {
+		groups, err := ParseGroups(test.value)
+		if (err == nil) != test.valid || !reflect.DeepEqual(groups, test.groups) {
+			t.Errorf("value:%q groups:%v error:%v, want groups:%v valid:%v", test.value, groups, err, test.groups, test.valid)
+		}
+		if err != nil {
+			continue
+		}
+		if parsed, _ := ParseGroups(FormatGroups(groups)); !reflect.DeepEqual(parsed, groups) {
+			t.Errorf("value:%q does not round trip:%s", test.value, FormatGroups(groups))
+		}
+	}
+}
+
+func TestParseGroupProviders(t *testing.T) {
+	tests := []struct {
+		value     string
+		providers []string
+		valid     bool
+	}{
+		{"", nil, true},
+		{"okta", []string{"okta:okta"}, true},
+		{"ldap:/corp-ldap/, github:gh", []string{"ldap:corp-ldap", "github:gh"}, true},
+		{"oidc:, okta:okta-eu", []string{"oidc:oidc", "okta:okta-eu"}, true},
+		{"jwt:ci", []string{"jwt:ci"}, true},
+		{"oidc,jwt", nil, false},
+		{"saml", nil, false},
+	}
+	for _, test := range tests {
+		providers, err := ParseGroupProviders(test.value)
+		var names []string
+		for _, p := range providers {
+			names = append(names, p.String())
+		}
+		if (err == nil) != test.valid || !reflect.DeepEqual(names, test.providers) {
+			t.Errorf("value:%q providers:%v error:%v, want providers:%v valid:%v", test.value, names, err, test.providers, test.valid)
+		}
+	}
+}
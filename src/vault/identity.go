@@ -0,0 +1,186 @@
+package vault
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// groupLocks serialize read-modify-write of group policies, groups are shared by namespaces
+// reconciled in parallel.
+type groupLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (l *groupLocks) lock(name string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	m, ok := l.locks[name]
+	if !ok {
+		m = new(sync.Mutex)
+		l.locks[name] = m
+	}
+	l.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
+// identityGroups tells if groups need an external identity group, for oidc and jwt aliases.
+func (v *Vault) identityGroups() bool {
+	for _, provider := range v.groupProviders {
+		if provider.identity() {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureIdentityGroup looks up external identity group by name and creates it or merges policy into
+// its policies, and returns the group id. Policies of the group are references of the namespaces sharing it.
+func (v *Vault) ensureIdentityGroup(name, policyName string) (string, undo, error) {
+	defer v.groups.lock("identity/" + name)()
+	groupPath := fmt.Sprintf("identity/group/name/%s", name)
+	group, err := v.api.Client().Logical().Read(groupPath)
+	if err != nil {
+		return "", nil, err
+	}
+	var u undo
+	switch {
+	case group == nil || group.Data == nil:
+		log.Infof("Writing identity group:%s", name)
+		group, err = v.api.Client().Logical().Write("identity/group", VaultData{
+			"name":     name,
+			"type":     "external",
+			"policies": []string{policyName},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		u = v.deletePath(groupPath)
+	case group.Data["type"] != "external":
+		return "", nil, fmt.Errorf("identity group:%s has type:%v, expected:external", name, group.Data["type"])
+	case !contains(group.Data["policies"], policyName):
+		log.Infof("Repairing identity group:%s, adding policy:%s", name, policyName)
+		policies := toStrings(group.Data["policies"])
+		_, err = v.api.Client().Logical().Write(groupPath, VaultData{
+			"policies": append(policies, policyName),
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		u = v.writePath(groupPath, VaultData{"policies": policies})
+	default:
+		log.Debugf("Identity group:%s is in sync", name)
+	}
+	if group == nil || group.Data == nil {
+		return "", u, fmt.Errorf("no data for identity group:%s", name)
+	}
+	id, ok := group.Data["id"].(string)
+	if !ok {
+		return "", u, fmt.Errorf("no group id in data:%v", group.Data)
+	}
+	return id, u, nil
+}
+
+// removeIdentityGroupPolicy removes policy from the identity group, the group and its alias are deleted
+// with the last policy.
+func (v *Vault) removeIdentityGroupPolicy(name, policyName string) error {
+	defer v.groups.lock("identity/" + name)()
+	return v.removePolicies(fmt.Sprintf("identity/group/name/%s", name), policyName)
+}
+
+// findGroupAlias returns id and canonical id of the alias with the name on the mount accessor.
+func (v *Vault) findGroupAlias(name, accessor string) (string, string, error) {
+	re, err := v.api.Client().Logical().List("identity/group-alias/id")
+	if err != nil || re == nil || re.Data == nil {
+		return "", "", err
+	}
+	info, _ := re.Data["key_info"].(map[string]interface{})
+	for id, item := range info {
+		alias, ok := item.(map[string]interface{})
+		if ok && alias["name"] == name && alias["mount_accessor"] == accessor {
+			canonicalID, _ := alias["canonical_id"].(string)
+			return id, canonicalID, nil
+		}
+	}
+	return "", "", nil
+}
+
+// ensureGroupAlias maps identity group to the group claim of the auth mount, an alias of the group
+// or an alias left by a deleted group is reused instead of creating another one.
+func (v *Vault) ensureGroupAlias(mount, group, groupID string) (undo, error) {
+	defer v.groups.lock("identity/" + group)()
+	auth, err := v.api.Client().Sys().ListAuth()
+	if err != nil {
+		return nil, err
+	}
+	accessor, ok := auth[mount+"/"]
+	if !ok {
+		return nil, fmt.Errorf("no auth mount:%s accessor", mount)
+	}
+	current, err := v.api.Client().Logical().Read(fmt.Sprintf("identity/group/id/%s", groupID))
+	if err != nil {
+		return nil, err
+	}
+	data := VaultData{
+		"name":           group,
+		"mount_accessor": accessor.Accessor,
+		"canonical_id":   groupID,
+	}
+	if current != nil && current.Data != nil {
+		if alias, ok := current.Data["alias"].(map[string]interface{}); ok && len(alias) > 0 {
+			if alias["name"] == group && alias["mount_accessor"] == accessor.Accessor {
+				log.Debugf("Identity group alias:%s is in sync", group)
+				return nil, nil
+			}
+			aliasID, _ := alias["id"].(string)
+			aliasPath := fmt.Sprintf("identity/group-alias/id/%s", aliasID)
+			log.Infof("Repairing identity group alias:%s", group)
+			if _, err := v.api.Client().Logical().Write(aliasPath, data); err != nil {
+				return nil, err
+			}
+			return v.writePath(aliasPath, VaultData{
+				"name":           alias["name"],
+				"mount_accessor": alias["mount_accessor"],
+				"canonical_id":   groupID,
+			}), nil
+		}
+	}
+	aliasID, canonicalID, err := v.findGroupAlias(group, accessor.Accessor)
+	if err != nil {
+		return nil, err
+	}
+	if len(aliasID) > 0 && canonicalID == groupID {
+		log.Debugf("Identity group alias:%s is in sync", group)
+		return nil, nil
+	}
+	if len(aliasID) > 0 {
+		owner, err := v.api.Client().Logical().Read(fmt.Sprintf("identity/group/id/%s", canonicalID))
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil && owner.Data != nil {
+			return nil, fmt.Errorf("identity group alias:%s is used by group:%v", group, owner.Data["name"])
+		}
+		aliasPath := fmt.Sprintf("identity/group-alias/id/%s", aliasID)
+		log.Infof("Reusing identity group alias:%s of group id:%s", group, canonicalID)
+		if _, err := v.api.Client().Logical().Write(aliasPath, data); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	log.Infof("Writing identity group alias:%s", group)
+	alias, err := v.api.Client().Logical().Write("identity/group-alias", data)
+	if err != nil {
+		return nil, err
+	}
+	if alias == nil || alias.Data == nil {
+		return nil, nil
+	}
+	id, _ := alias.Data["id"].(string)
+	return v.deletePath(fmt.Sprintf("identity/group-alias/id/%s", id)), nil
+}
@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Login methods of vaultlink itself.
+const (
+	AuthToken      = "token"
+	AuthKubernetes = "kubernetes"
+	AuthJWT        = "jwt"
+	AuthAppRole    = "approle"
+	AuthCert       = "cert"
+)
+
+func readFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// login writes credentials to the login path of the auth mount.
+func (v *Vault) login(mount string, data VaultData) (*api.Secret, error) {
+	re, err := v.api.Client().Logical().Write("auth/"+mount+"/login", data)
+	if err != nil {
+		return nil, fmt.Errorf("login to auth path:%s error:%s", mount, err)
+	}
+	if re == nil || re.Auth == nil {
+		return nil, fmt.Errorf("no auth data in login response of auth path:%s", mount)
+	}
+	return re, nil
+}
+
+// JWTLogin logs in with the JWT of jwtPath to authPath as role@mount, mount is jwt if authPath is empty,
+// the JWT is read on every login to pick up rotated tokens.
+func (v *Vault) JWTLogin(jwtPath, authPath string) LoginFunc {
+	if len(authPath) == 0 {
+		authPath = AuthJWT
+	}
+	return func() (*api.Secret, error) {
+		role, mount := parseAuthPath(authPath)
+		jwt, err := readFile(jwtPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't read jwt token at %s, error:%s", jwtPath, err)
+		}
+		return v.login(mount, VaultData{"role": role, "jwt": jwt})
+	}
+}
+
+// AppRoleLogin logs in to approle mount with role id and secret id files, a wrapped secret id is unwrapped
+// first, it can be used once so the file has to be refreshed before the next login.
+func (v *Vault) AppRoleLogin(mount, roleIDPath, secretIDPath string, wrapped bool) LoginFunc {
+	if len(mount) == 0 {
+		mount = AuthAppRole
+	}
+	return func() (*api.Secret, error) {
+		roleID, err := readFile(roleIDPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't read role id at %s, error:%s", roleIDPath, err)
+		}
+		secretID, err := readFile(secretIDPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't read secret id at %s, error:%s", secretIDPath, err)
+		}
+		if wrapped {
+			log.Debugf("Unwrapping secret id")
+			re, err := v.api.Client().Logical().Unwrap(secretID)
+			if err != nil {
+				return nil, fmt.Errorf("can't unwrap secret id, error:%s", err)
+			}
+			if re == nil || re.Data == nil {
+				return nil, fmt.Errorf("no secret id in wrapped response")
+			}
+			secretID = fmt.Sprint(re.Data["secret_id"])
+		}
+		return v.login(mount, VaultData{"role_id": roleID, "secret_id": secretID})
+	}
+}
+
+// CertLogin logs in with the TLS client certificate to authPath as role@mount, the role may be omitted
+// to let vault pick a matching certificate role.
+func (v *Vault) CertLogin(authPath string) LoginFunc {
+	return func() (*api.Secret, error) {
+		mount, data := AuthCert, VaultData{}
+		if len(authPath) > 0 {
+			var role string
+			role, mount = parseAuthPath(authPath)
+			if strings.Contains(authPath, "@") {
+				data["name"] = role
+			}
+		}
+		return v.login(mount, data)
+	}
+}
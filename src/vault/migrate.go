@@ -0,0 +1,61 @@
+package vault
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+const migratePollInterval = 2 * time.Second
+
+// MigrateKV upgrades kv version 1 secrets path of the namespace to version 2 in place
+// and waits until vault finishes the upgrade, it does nothing for version 2 paths.
+func (v *Vault) MigrateKV(spec *BindSpec, timeout time.Duration) error {
+	v, err := v.scope(spec)
+	if err != nil {
+		return stepError("namespace", spec.Namespace, err)
+	}
+	secretsPath := v.makeSecretsPathName(spec.Cluster, spec.Namespace, spec.ServiceAccount)
+	mounts, err := v.api.Client().Sys().ListMounts()
+	if err != nil {
+		return stepError("migrate", secretsPath, err)
+	}
+	mount, ok := mounts[secretsPath+"/"]
+	if !ok {
+		return stepError("migrate", secretsPath, fmt.Errorf("secrets path is not mounted"))
+	}
+	if mount.Type != "kv" {
+		return stepError("migrate", secretsPath, fmt.Errorf("secrets path has type:%s, expected:kv", mount.Type))
+	}
+	if kvVersion(mount.Options) == "2" {
+		log.Infof("Secrets path:%s is kv version 2 already", secretsPath)
+		return nil
+	}
+	log.Infof("Upgrading secrets path:%s to kv version 2", secretsPath)
+	if err := v.api.Client().Sys().TuneMount(secretsPath, api.MountConfigInput{Options: map[string]string{"version": "2"}}); err != nil {
+		return stepError("migrate", secretsPath, err)
+	}
+	if err := v.waitKV(secretsPath+"/config", timeout); err != nil {
+		return stepError("migrate-wait", secretsPath, err)
+	}
+	log.Infof("Upgraded secrets path:%s to kv version 2", secretsPath)
+	return nil
+}
+
+// waitKV polls kv version 2 config path, vault rejects requests while it upgrades the data.
+func (v *Vault) waitKV(path string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := v.api.Client().Logical().Read(path)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("upgrade is not finished after %s, last error:%s", timeout, err)
+		}
+		log.Debugf("Waiting for kv upgrade of path:%s, error:%s", path, err)
+		time.Sleep(migratePollInterval)
+	}
+}
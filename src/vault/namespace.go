@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path"
+	"strings"
+
+	multierror "github.com/hashicorp/go-multierror"
+	log "github.com/sirupsen/logrus"
+)
+
+// SetNamespace sets vault enterprise namespace of all calls, it must be called before Start.
+func (v *Vault) SetNamespace(namespace string) *Vault {
+	v.namespace = strings.Trim(namespace, "/")
+	return v
+}
+
+// SetNamespaceTemplate makes every kubernetes namespace bind in its own child namespace of the vault namespace,
+// vaultlink creates it on bind and deletes it on unbind.
+func (v *Vault) SetNamespaceTemplate(tmpl string) error {
+	if len(tmpl) == 0 {
+		v.namespaceTmpl = nil
+		return nil
+	}
+	t, err := template.New("namespace").Parse(tmpl)
+	if err != nil {
+		return err
+	}
+	v.namespaceTmpl = t
+	return nil
+}
+
+// makeNamespaceName renders the child namespace path relative to the vault namespace, empty parts are rejected.
+func (v *Vault) makeNamespaceName(cluster, namespace, sa string) (string, error) {
+	var buf bytes.Buffer
+	if err := v.namespaceTmpl.Execute(&buf, Tmpl{cluster, namespace, sa}); err != nil {
+		return "", err
+	}
+	name := strings.Trim(buf.String(), "/")
+	for _, part := range strings.Split(name, "/") {
+		if len(strings.TrimSpace(part)) == 0 {
+			return "", fmt.Errorf("namespace template rendered invalid namespace:%q", name)
+		}
+	}
+	return name, nil
+}
+
+// inNamespace returns a copy of v with a client of the vault namespace, the token is copied
+// so the copy must not outlive a single bind.
+func (v *Vault) inNamespace(namespace string) (*Vault, error) {
+	client, err := v.api.Client().Clone()
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(v.api.Client().Token())
+	client.SetNamespace(namespace)
+	scoped := *v
+	scoped.api = &VaultApi{client: client}
+	scoped.namespace = namespace
+	return &scoped, nil
+}
+
+// scope returns v for the child namespace of spec, or v itself without namespace template.
+func (v *Vault) scope(spec *BindSpec) (*Vault, error) {
+	if v.namespaceTmpl == nil {
+		return v, nil
+	}
+	name, err := v.makeNamespaceName(spec.Cluster, spec.Namespace, spec.ServiceAccount)
+	if err != nil {
+		return nil, err
+	}
+	return v.inNamespace(path.Join(v.namespace, name))
+}
+
+// missingNamespaces returns namespaces on the path from v to its child namespace that do not exist, parents first.
+func (v *Vault) missingNamespaces(namespace string) ([]string, error) {
+	var missing []string
+	parent := v.namespace
+	for _, name := range strings.Split(strings.Trim(strings.TrimPrefix(namespace, v.namespace), "/"), "/") {
+		child := path.Join(parent, name)
+		parent = child
+		// children of a missing namespace are missing too
+		if len(missing) == 0 {
+			exists, err := v.namespaceExists(child)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				log.Debugf("Vault namespace:%s is in sync", child)
+				continue
+			}
+		}
+		missing = append(missing, child)
+	}
+	return missing, nil
+}
+
+func (v *Vault) namespaceExists(namespace string) (bool, error) {
+	parent, name := path.Split(namespace)
+	pv, err := v.inNamespace(strings.Trim(parent, "/"))
+	if err != nil {
+		return false, err
+	}
+	re, err := pv.api.Client().Logical().Read("sys/namespaces/" + name)
+	return re != nil, err
+}
+
+// ensureNamespace creates namespace unless it exists, undo deletes it only if it was created.
+func (v *Vault) ensureNamespace(namespace string) (undo, error) {
+	exists, err := v.namespaceExists(namespace)
+	if err != nil || exists {
+		return nil, err
+	}
+	parent, name := path.Split(namespace)
+	pv, err := v.inNamespace(strings.Trim(parent, "/"))
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Creating vault namespace:%s", namespace)
+	if _, err = pv.api.Client().Logical().Write("sys/namespaces/"+name, VaultData{}); err != nil {
+		return nil, err
+	}
+	return func() error { return v.deleteNamespace(namespace) }, nil
+}
+
+func (v *Vault) deleteNamespace(namespace string) error {
+	parent, name := path.Split(namespace)
+	pv, err := v.inNamespace(strings.Trim(parent, "/"))
+	if err != nil {
+		return err
+	}
+	log.Infof("Deleting vault namespace:%s", namespace)
+	_, err = pv.api.Client().Logical().Delete("sys/namespaces/" + name)
+	return err
+}
+
+// Bind creates or repairs all vault resources of the namespace, in its child vault namespace
+// if namespace template is set. Missing namespaces are created in the same transaction and deleted
+// on rollback. Groups stay in the vault namespace with auth mounts of group providers, their policies
+// reach the child namespace by its path.
+func (v *Vault) Bind(spec *BindSpec) (*BindInfo, error) {
+	scoped, err := v.scope(spec)
+	if err != nil {
+		return nil, stepError("namespace", spec.Namespace, err)
+	}
+	tx := new(transaction)
+	if scoped != v {
+		missing, err := v.missingNamespaces(scoped.namespace)
+		if err != nil {
+			return nil, stepError("namespace", scoped.namespace, err)
+		}
+		for _, namespace := range missing {
+			namespace := namespace
+			tx.add("namespace", namespace, func() (undo, error) {
+				return v.ensureNamespace(namespace)
+			})
+		}
+	}
+	return scoped.bind(spec, v, tx)
+}
+
+// Unbind removes all vault resources of the namespace, and its child vault namespace
+// if namespace template is set.
+func (v *Vault) Unbind(spec *BindSpec) error {
+	scoped, err := v.scope(spec)
+	if err != nil {
+		return stepError("namespace", spec.Namespace, err)
+	}
+	var errs *multierror.Error
+	if err := scoped.unbind(spec, v); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if scoped == v {
+		return errs.ErrorOrNil()
+	}
+	if err := v.deleteNamespace(scoped.namespace); err != nil {
+		log.Errorf("Delete vault namespace:%s error:%s", scoped.namespace, err)
+		errs = multierror.Append(errs, stepError("namespace", scoped.namespace, err))
+	}
+	return errs.ErrorOrNil()
+}
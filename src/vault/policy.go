@@ -0,0 +1,133 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+
+	"github.com/hashicorp/hcl"
+)
+
+const (
+	TierReadOnly  = "read-only"
+	TierReadWrite = "read-write"
+	TierAdmin     = "admin"
+)
+
+// defaultPolicyTemplates are built-in policy tiers, a template file or ConfigMap may override them.
+const defaultPolicyTemplates = `
+{{- define "read-only" -}}
+{{- if eq .KVVersion 2 -}}
+path "{{ .SecretsPath }}/data/*" {
+capabilities = ["read", "list"]
+}
+path "{{ .SecretsPath }}/metadata/*" {
+capabilities = ["read", "list"]
+}
+{{- else -}}
+path "{{ .SecretsPath }}/*" {
+capabilities = ["read", "list"]
+}
+{{- end -}}
+{{- end -}}
+
+{{- define "read-write" -}}
+{{- if eq .KVVersion 2 -}}
+path "{{ .SecretsPath }}/data/*" {
+capabilities = ["create", "read", "update", "delete", "list"]
+}
+path "{{ .SecretsPath }}/metadata/*" {
+capabilities = ["read", "delete", "list"]
+}
+{{- else -}}
+path "{{ .SecretsPath }}/*" {
+capabilities = ["create", "read", "update", "delete", "list"]
+}
+{{- end -}}
+{{- end -}}
+
+{{- define "admin" -}}
+path "{{ .SecretsPath }}/*" {
+capabilities = ["create", "read", "update", "delete", "list", "sudo"]
+}
+{{- end -}}
+`
+
+// PolicyData is available to policy templates.
+type PolicyData struct {
+	Tmpl
+	SecretsPath string
+	KVVersion   int
+	// Labels are namespace labels, their values are restricted to characters safe in HCL strings.
+	Labels map[string]string
+}
+
+// PolicyTemplates are named policy tiers.
+type PolicyTemplates struct {
+	tmpl  *template.Template
+	tiers map[string]bool
+}
+
+// newPolicyTemplates takes every template defined in tmpl as a tier, except the parsed roots in skip.
+func newPolicyTemplates(tmpl *template.Template, skip ...string) *PolicyTemplates {
+	tiers := make(map[string]bool)
+	for _, t := range tmpl.Templates() {
+		tiers[t.Name()] = true
+	}
+	for _, name := range append(skip, tmpl.Name()) {
+		delete(tiers, name)
+	}
+	return &PolicyTemplates{tmpl, tiers}
+}
+
+// NewPolicyTemplates parses templates as tier name to template body on top of the built-in tiers.
+func NewPolicyTemplates(templates map[string]string) (*PolicyTemplates, error) {
+	tmpl, err := template.New("policy").Parse(defaultPolicyTemplates)
+	if err != nil {
+		return nil, err
+	}
+	for name, body := range templates {
+		if _, err := tmpl.New(name).Parse(body); err != nil {
+			return nil, fmt.Errorf("policy template:%s error:%s", name, err)
+		}
+	}
+	return newPolicyTemplates(tmpl), nil
+}
+
+// LoadPolicyTemplates reads tiers from a file of {{ define "tier" }} blocks.
+func LoadPolicyTemplates(path string) (*PolicyTemplates, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("policy").Parse(defaultPolicyTemplates)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.New(path).Parse(string(body)); err != nil {
+		return nil, fmt.Errorf("policy template file:%s error:%s", path, err)
+	}
+	return newPolicyTemplates(tmpl, path), nil
+}
+
+// HasTier tells if a template defines tier.
+func (p *PolicyTemplates) HasTier(tier string) bool {
+	return p.tiers[tier]
+}
+
+// Render executes the tier template and checks the result is valid HCL.
+func (p *PolicyTemplates) Render(tier string, data PolicyData) (string, error) {
+	if !p.HasTier(tier) {
+		return "", fmt.Errorf("unknown policy tier:%s", tier)
+	}
+	t := p.tmpl.Lookup(tier)
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("policy tier:%s error:%s", tier, err)
+	}
+	if _, err := hcl.Parse(buf.String()); err != nil {
+		return "", fmt.Errorf("policy tier:%s invalid hcl:%s", tier, err)
+	}
+	return buf.String(), nil
+}
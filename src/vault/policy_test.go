@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPolicyTiers(t *testing.T) {
+	file, err := ioutil.TempFile("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(`{{ define "team-read" }}path "{{ .SecretsPath }}/*" { capabilities = ["read"] }{{ end }}`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	fromFile, err := LoadPolicyTemplates(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromMap, err := NewPolicyTemplates(map[string]string{"team-read": `path "{{ .SecretsPath }}/*" { capabilities = ["read"] }`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tier  string
+		valid bool
+	}{
+		{TierReadOnly, true},
+		{TierReadWrite, true},
+		{TierAdmin, true},
+		{"team-read", true},
+		{"policy", false},
+		{file.Name(), false},
+		{"", false},
+		{"unknown", false},
+	}
+	for _, policies := range []*PolicyTemplates{fromFile, fromMap} {
+		for _, test := range tests {
+			_, err := policies.Render(test.tier, PolicyData{SecretsPath: "k8s/c/ns", KVVersion: 1})
+			if (err == nil) != test.valid {
+				t.Errorf("tier:%q valid:%v error:%v", test.tier, test.valid, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package vault
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTokenTTL = 24 * time.Hour
+
+// rulePath matches policy rule paths, segments of letters, digits and _.-+* separated by slashes.
+var rulePath = regexp.MustCompile(`^[A-Za-z0-9_.+*-]+(/[A-Za-z0-9_.+*-]+)*/?$`)
+
+// capabilities are policy rule capabilities.
+var capabilities = []string{"create", "read", "update", "patch", "delete", "list", "sudo", "deny"}
+
+// PolicyRule grants capabilities on a path relative to the namespace secrets path.
+type PolicyRule struct {
+	Path         string
+	Capabilities []string
+}
+
+// Role is a vault role of the namespace auth mount for a service account.
+type Role struct {
+	ServiceAccount string
+	// BoundNamespaces are namespaces the service account may log in from, the bound namespace alone if empty.
+	BoundNamespaces []string
+	// Policies are attached to the role in addition to the namespace policy.
+	Policies    []string
+	TokenTTL    time.Duration
+	TokenMaxTTL time.Duration
+}
+
+// BindSpec is the desired vault state of a namespace.
+type BindSpec struct {
+	Cluster   string
+	Namespace string
+	// ServiceAccount reviews tokens for the auth method and is used in name templates.
+	ServiceAccount string
+	// Roles are vault roles of the auth mount, a role for ServiceAccount alone if empty.
+	Roles    []Role
+	KubeAddr string
+	Groups   []Group
+	// Targets are names of vault targets the namespace is bound to, BoundTargets are targets of the
+	// previous bind, they are resolved by the caller.
+	Targets      []string
+	BoundTargets []string
+	// BoundGroups are groups of the previous bind, mappings of groups no longer in Groups are removed.
+	BoundGroups []Group
+	// Token is the token reviewer JWT, it is not written unless auth config drifts or RewriteConfig is set.
+	Token         []byte
+	CA            []byte
+	RewriteConfig bool
+	// ClientReviewer makes vault review client tokens with the client JWT itself instead of Token.
+	ClientReviewer bool
+	// Rules replace the policy tier on secrets path if not empty.
+	Rules []PolicyRule
+	// PolicyTier is the policy template, read-write if empty.
+	PolicyTier string
+	Labels     map[string]string
+	// KVVersion is the kv version the namespace asks for, a secrets path with another version fails the bind.
+	KVVersion int
+	// KVDefault is the kv version of new secrets paths without KVVersion, existing ones keep their version.
+	KVDefault int
+	// KVMaxVersions, KVCASRequired and KVDeleteVersionAfter tune kv version 2 secrets path.
+	KVMaxVersions        int
+	KVCASRequired        bool
+	KVDeleteVersionAfter time.Duration
+	// TokenTTL, TokenMaxTTL, TokenNumUses, TokenPolicies and TokenBoundCIDRs apply to every role,
+	// role ttls override them and role policies are added.
+	TokenTTL        time.Duration
+	TokenMaxTTL     time.Duration
+	TokenNumUses    int
+	TokenPolicies   []string
+	TokenBoundCIDRs []string
+}
+
+// EffectiveRoles returns roles written on bind.
+func (s *BindSpec) EffectiveRoles() []Role {
+	return s.roles()
+}
+
+func (s *BindSpec) roles() []Role {
+	if len(s.Roles) == 0 {
+		return []Role{{ServiceAccount: s.ServiceAccount}}
+	}
+	return s.Roles
+}
+
+// RoleServiceAccounts returns service accounts that get a vault role.
+func (s *BindSpec) RoleServiceAccounts() []string {
+	var re []string
+	for _, role := range s.roles() {
+		re = append(re, role.ServiceAccount)
+	}
+	return re
+}
+
+// roleData returns vault role of the service account with the namespace policy.
+func (s *BindSpec) roleData(role Role, policyName string) VaultData {
+	namespaces := role.BoundNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{s.Namespace}
+	}
+	ttl, maxTTL := s.RoleTTLs(role)
+	policies := append([]string{policyName}, s.TokenPolicies...)
+	cidrs := append([]string{}, s.TokenBoundCIDRs...)
+	return VaultData{
+		"bound_service_account_names":      []string{role.ServiceAccount},
+		"bound_service_account_namespaces": namespaces,
+		"policies":                         append(policies, role.Policies...),
+		"token_num_uses":                   s.TokenNumUses,
+		"token_ttl":                        int(ttl.Seconds()),
+		"token_max_ttl":                    int(maxTTL.Seconds()),
+		"token_bound_cidrs":                cidrs,
+	}
+}
+
+func (s *BindSpec) authConfig() VaultData {
+	cfg := VaultData{
+		"kubernetes_host":    s.KubeAddr,
+		"kubernetes_ca_cert": string(s.CA),
+	}
+	if s.ClientReviewer {
+		cfg["disable_local_ca_jwt"] = true
+	} else {
+		cfg["token_reviewer_jwt"] = string(s.Token)
+	}
+	return cfg
+}
+
+// authConfigKeys are auth config keys vault returns on read.
+func (s *BindSpec) authConfigKeys() []string {
+	var re []string
+	for key := range s.authConfig() {
+		if key != "token_reviewer_jwt" {
+			re = append(re, key)
+		}
+	}
+	return re
+}
+
+func (s *BindSpec) kvVersion() int {
+	switch {
+	case s.KVVersion != 0:
+		return s.KVVersion
+	case s.KVDefault != 0:
+		return s.KVDefault
+	}
+	return 1
+}
+
+// kvConfig returns kv version 2 secrets path config.
+func (s *BindSpec) kvConfig() VaultData {
+	return VaultData{
+		"max_versions":         s.KVMaxVersions,
+		"cas_required":         s.KVCASRequired,
+		"delete_version_after": s.KVDeleteVersionAfter.String(),
+	}
+}
+
+// RoleTTLs returns token ttl and max ttl written to the role, 0 max ttl is the mount max ttl.
+// The default ttl is cut to max ttl.
+func (s *BindSpec) RoleTTLs(role Role) (time.Duration, time.Duration) {
+	maxTTL := role.TokenMaxTTL
+	if maxTTL == 0 {
+		maxTTL = s.TokenMaxTTL
+	}
+	ttl := role.TokenTTL
+	if ttl == 0 {
+		ttl = s.TokenTTL
+	}
+	if ttl == 0 {
+		ttl = defaultTokenTTL
+		if maxTTL > 0 && ttl > maxTTL {
+			ttl = maxTTL
+		}
+	}
+	return ttl, maxTTL
+}
+
+// groupPolicy returns policy name of the group tier, tier policies are named policyName/tier.
+func (s *BindSpec) groupPolicy(policyName string, group Group) string {
+	if len(group.Tier) == 0 || group.Tier == s.policyTier() {
+		return policyName
+	}
+	return policyName + "/" + group.Tier
+}
+
+// tierPolicies returns policy names of group tiers other than the namespace tier mapped to tiers.
+func (s *BindSpec) tierPolicies(policyName string, groups []Group) map[string]string {
+	re := make(map[string]string)
+	for _, group := range groups {
+		if name := s.groupPolicy(policyName, group); name != policyName {
+			re[name] = group.Tier
+		}
+	}
+	return re
+}
+
+func (s *BindSpec) policyTier() string {
+	if len(s.PolicyTier) == 0 {
+		return TierReadWrite
+	}
+	return s.PolicyTier
+}
+
+// Validate rejects specs that would give access outside of the namespace secrets path.
+func (s *BindSpec) Validate() error {
+	if version := s.kvVersion(); version != 1 && version != 2 {
+		return fmt.Errorf("unsupported kv version:%d", version)
+	}
+	if s.kvVersion() == 1 && (s.KVMaxVersions != 0 || s.KVCASRequired || s.KVDeleteVersionAfter != 0) {
+		return fmt.Errorf("kv version 1 has no max versions, cas required or delete version after")
+	}
+	if s.KVMaxVersions < 0 || s.KVDeleteVersionAfter < 0 {
+		return fmt.Errorf("negative kv max versions or delete version after")
+	}
+	seen := make(map[string]bool)
+	for _, role := range s.roles() {
+		if len(role.ServiceAccount) == 0 {
+			return fmt.Errorf("role has no service account")
+		}
+		if seen[role.ServiceAccount] {
+			return fmt.Errorf("duplicate role for service account:%s", role.ServiceAccount)
+		}
+		seen[role.ServiceAccount] = true
+		ttl, maxTTL := s.RoleTTLs(role)
+		if maxTTL > 0 && ttl > maxTTL {
+			return fmt.Errorf("role:%s token ttl:%s exceeds max ttl:%s", role.ServiceAccount, ttl, maxTTL)
+		}
+	}
+	if s.TokenNumUses < 0 {
+		return fmt.Errorf("negative token num uses:%d", s.TokenNumUses)
+	}
+	for _, rule := range s.Rules {
+		if !rulePath.MatchString(rule.Path) || strings.Contains(rule.Path, "..") {
+			return fmt.Errorf("policy rule path:%q must be relative to secrets path", rule.Path)
+		}
+		if len(rule.Capabilities) == 0 {
+			return fmt.Errorf("policy rule path:%s has no capabilities", rule.Path)
+		}
+		for _, capability := range rule.Capabilities {
+			if !contains(capabilities, capability) {
+				return fmt.Errorf("policy rule path:%s unknown capability:%q", rule.Path, capability)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *BindSpec) rulesPolicy(secretsPath string) string {
+	var rules []string
+	for _, rule := range s.Rules {
+		var quoted []string
+		for _, capability := range rule.Capabilities {
+			quoted = append(quoted, strconv.Quote(capability))
+		}
+		rules = append(rules, fmt.Sprintf("path %s {\ncapabilities = [%s]\n}",
+			strconv.Quote(secretsPath+"/"+rule.Path), strings.Join(quoted, ", ")))
+	}
+	return strings.Join(rules, "\n")
+}
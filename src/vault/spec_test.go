@@ -0,0 +1,78 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl"
+)
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		capabilities []string
+		valid        bool
+	}{
+		{"glob", "*", []string{"read", "list"}, true},
+		{"nested", "app/config/*", []string{"read"}, true},
+		{"segment wildcard", "app/+/db", []string{"read"}, true},
+		{"trailing slash", "app/", []string{"list"}, true},
+		{"absolute", "/sys/*", []string{"read"}, false},
+		{"parent", "app/../../x", []string{"read"}, false},
+		{"empty segment", "app//x", []string{"read"}, false},
+		{"empty", "", []string{"read"}, false},
+		{"injection", "x\" {\ncapabilities = [\"read\"]\n}\npath \"*", []string{"sudo", "read", "update"}, false},
+		{"quote", `x"`, []string{"read"}, false},
+		{"braces", "x{}", []string{"read"}, false},
+		{"space", "x y", []string{"read"}, false},
+		{"no capabilities", "x", nil, false},
+		{"unknown capability", "x", []string{"root"}, false},
+		{"capability injection", "x", []string{`read"] } path "*" { capabilities = ["sudo`}, false},
+	}
+	for _, test := range tests {
+		spec := &BindSpec{ServiceAccount: "default", Rules: []PolicyRule{{Path: test.path, Capabilities: test.capabilities}}}
+		if err := spec.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: path:%q valid:%v error:%v", test.name, test.path, test.valid, err)
+		}
+	}
+}
+
+func TestRulesPolicy(t *testing.T) {
+	spec := &BindSpec{Rules: []PolicyRule{{Path: "app/*", Capabilities: []string{"read", "list"}}}}
+	policy := spec.rulesPolicy("k8s/c/ns")
+	want := "path \"k8s/c/ns/app/*\" {\ncapabilities = [\"read\", \"list\"]\n}"
+	if policy != want {
+		t.Fatalf("policy:%q want:%q", policy, want)
+	}
+	if _, err := hcl.Parse(policy); err != nil {
+		t.Fatalf("invalid hcl:%s", err)
+	}
+	if strings.Count(policy, "path ") != 1 {
+		t.Fatalf("policy has more than one path:%s", policy)
+	}
+}
+
+func TestRoleTTLs(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        BindSpec
+		role        Role
+		ttl, maxTTL time.Duration
+	}{
+		{"defaults", BindSpec{}, Role{}, defaultTokenTTL, 0},
+		{"default ttl cut to max ttl", BindSpec{TokenMaxTTL: time.Hour}, Role{}, time.Hour, time.Hour},
+		{"default ttl below max ttl", BindSpec{TokenMaxTTL: 48 * time.Hour}, Role{}, defaultTokenTTL, 48 * time.Hour},
+		{"namespace ttls", BindSpec{TokenTTL: time.Hour, TokenMaxTTL: 8 * time.Hour}, Role{}, time.Hour, 8 * time.Hour},
+		{"role overrides namespace", BindSpec{TokenTTL: time.Hour, TokenMaxTTL: 8 * time.Hour}, Role{TokenTTL: time.Minute, TokenMaxTTL: 2 * time.Hour}, time.Minute, 2 * time.Hour},
+		{"role max ttl cuts default ttl", BindSpec{TokenMaxTTL: 48 * time.Hour}, Role{TokenMaxTTL: 2 * time.Hour}, 2 * time.Hour, 2 * time.Hour},
+		{"explicit ttl is not cut", BindSpec{TokenTTL: 4 * time.Hour}, Role{TokenMaxTTL: 2 * time.Hour}, 4 * time.Hour, 2 * time.Hour},
+	}
+	for _, test := range tests {
+		ttl, maxTTL := test.spec.RoleTTLs(test.role)
+		if ttl != test.ttl || maxTTL != test.maxTTL {
+			t.Errorf("%s: ttl:%s max ttl:%s, want ttl:%s max ttl:%s", test.name, ttl, maxTTL, test.ttl, test.maxTTL)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package vault
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TLSFiles configure TLS of the vault client, certificate files are reloaded on the next
+// connection after they change.
+type TLSFiles struct {
+	CACert     string
+	CAPath     string
+	ClientCert string
+	ClientKey  string
+	ServerName string
+	Insecure   bool
+}
+
+// tlsReloader keeps certificates loaded from TLSFiles with modification times of the files.
+type tlsReloader struct {
+	files      TLSFiles
+	serverName string
+	mu         sync.Mutex
+	modTimes   map[string]time.Time
+	cert       *tls.Certificate
+	roots      *x509.CertPool
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// changed tells if any of paths changed since the last call and records their modification times.
+func (r *tlsReloader) changed(paths ...string) bool {
+	changed := false
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		t := modTime(path)
+		if last, ok := r.modTimes[path]; !ok || !last.Equal(t) {
+			r.modTimes[path] = t
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (r *tlsReloader) clientCert(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.changed(r.files.ClientCert, r.files.ClientKey) || r.cert == nil {
+		cert, err := tls.LoadX509KeyPair(r.files.ClientCert, r.files.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load vault client certificate:%s error:%s", r.files.ClientCert, err)
+		}
+		if r.cert != nil {
+			log.Infof("Reloaded vault client certificate:%s", r.files.ClientCert)
+		}
+		r.cert = &cert
+	}
+	return r.cert, nil
+}
+
+func (r *tlsReloader) rootCAs() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.changed(r.files.CACert, r.files.CAPath) && r.roots != nil {
+		return r.roots, nil
+	}
+	pool := x509.NewCertPool()
+	files := []string{}
+	if len(r.files.CACert) > 0 {
+		files = append(files, r.files.CACert)
+	}
+	if len(r.files.CAPath) > 0 {
+		matches, err := filepath.Glob(filepath.Join(r.files.CAPath, "*"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	for _, file := range files {
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			continue
+		}
+		pem, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read vault CA:%s error:%s", file, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) && file == r.files.CACert {
+			return nil, fmt.Errorf("no certificates in vault CA:%s", file)
+		}
+	}
+	if r.roots != nil {
+		log.Infof("Reloaded vault CA certificates")
+	}
+	r.roots = pool
+	return pool, nil
+}
+
+// verify checks the server certificate chain against the current CA certificates, it replaces
+// the built-in verification that can't reload CA certificates.
+func (r *tlsReloader) verify(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("vault server sent no certificates")
+	}
+	roots, err := r.rootCAs()
+	if err != nil {
+		return err
+	}
+	opts := x509.VerifyOptions{Roots: roots, DNSName: r.serverName, Intermediates: x509.NewCertPool()}
+	var leaf *x509.Certificate
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			leaf = cert
+		} else {
+			opts.Intermediates.AddCert(cert)
+		}
+	}
+	_, err = leaf.Verify(opts)
+	return err
+}
+
+// config returns TLS config of the vault client for addr.
+func (f *TLSFiles) config(addr string) (*tls.Config, error) {
+	r := &tlsReloader{files: *f, serverName: f.ServerName, modTimes: make(map[string]time.Time)}
+	if len(r.serverName) == 0 {
+		if u, err := url.Parse(addr); err == nil {
+			r.serverName = u.Hostname()
+		}
+	}
+	cfg := &tls.Config{ServerName: r.serverName, MinVersion: tls.VersionTLS12}
+	if len(f.ClientCert) > 0 {
+		if _, err := r.clientCert(nil); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = r.clientCert
+	}
+	switch {
+	case f.Insecure:
+		log.Warnf("!!! TLS verification of vault server %s is DISABLED, do not use it in production !!!", addr)
+		cfg.InsecureSkipVerify = true
+	case len(f.CACert) > 0 || len(f.CAPath) > 0:
+		if _, err := r.rootCAs(); err != nil {
+			return nil, err
+		}
+		// verification is done by verify with reloaded CA certificates
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = r.verify
+	}
+	return cfg, nil
+}
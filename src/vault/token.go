@@ -0,0 +1,198 @@
+package vault
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	loginRetryDelay    = time.Second
+	loginRetryMaxDelay = time.Minute
+)
+
+// LoginFunc logs in to vault and returns the auth secret of the new token.
+type LoginFunc func() (*api.Secret, error)
+
+// tokenState is the expiry of the current vault token, and the error that keeps vault unavailable
+// until the first login.
+type tokenState struct {
+	mu     sync.Mutex
+	expiry time.Time
+	err    error
+}
+
+func (t *tokenState) setErr(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+func (t *tokenState) set(ttl time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ttl == 0 {
+		t.expiry = time.Time{}
+		return
+	}
+	t.expiry = time.Now().Add(ttl)
+}
+
+// Available returns nil once Start connected and logged in, the last failure before.
+func (v *Vault) Available() error {
+	v.token.mu.Lock()
+	defer v.token.mu.Unlock()
+	return v.token.err
+}
+
+// Start connects and logs in with login, or uses the static token without login, and retries with
+// backoff until it succeeds, then it keeps the token renewed as WatchToken does.
+func (v *Vault) Start(login LoginFunc, unwrap bool, token string) {
+	delay := loginRetryDelay
+	for {
+		err := v.start(login, &unwrap, &token)
+		v.token.setErr(err)
+		if err == nil {
+			break
+		}
+		log.Errorf("Vault addr:%s is unavailable, error:%s, retry in:%s", v.addr, err, delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > loginRetryMaxDelay {
+			delay = loginRetryMaxDelay
+		}
+	}
+	log.Infof("Vault addr:%s is available", v.addr)
+	v.WatchToken(login)
+}
+
+func (v *Vault) start(login LoginFunc, unwrap *bool, token *string) error {
+	if err := v.connect(); err != nil {
+		return err
+	}
+	if login != nil {
+		secret, err := login()
+		if err != nil {
+			return err
+		}
+		*token, *unwrap = secret.Auth.ClientToken, false
+	}
+	if err := v.setToken(*unwrap, *token); err != nil {
+		return err
+	}
+	// a wrapped token can be unwrapped once, retries use the unwrapped token
+	*token, *unwrap = v.api.Client().Token(), false
+	return v.Ping()
+}
+
+// TokenExpiry returns expiry of the vault token, zero time if it does not expire.
+func (v *Vault) TokenExpiry() time.Time {
+	v.token.mu.Lock()
+	defer v.token.mu.Unlock()
+	return v.token.expiry
+}
+
+// Login logs in with kubernetes auth to kubeAuth as role@mount, mount is kubernetes if kubeAuth is empty,
+// the JWT is read on every login to pick up rotated tokens.
+func (v *Vault) Login(kubeTokenPath, kubeAuth string) (*api.Secret, error) {
+	if len(kubeAuth) == 0 {
+		kubeAuth = AuthKubernetes
+	}
+	return v.JWTLogin(kubeTokenPath, kubeAuth)()
+}
+
+// lookupToken returns auth secret of the current token.
+func (v *Vault) lookupToken() (*api.Secret, error) {
+	re, err := v.api.Client().Auth().Token().LookupSelf()
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := re.TokenTTL()
+	if err != nil {
+		return nil, err
+	}
+	renewable, err := re.TokenIsRenewable()
+	if err != nil {
+		return nil, err
+	}
+	return &api.Secret{Auth: &api.SecretAuth{
+		ClientToken:   v.api.Client().Token(),
+		Renewable:     renewable,
+		LeaseDuration: int(ttl.Seconds()),
+	}}, nil
+}
+
+// WatchToken renews the vault token and logs in again with login when it can't be renewed any more,
+// without login it stops when the token can't be renewed.
+func (v *Vault) WatchToken(login LoginFunc) {
+	secret, err := v.lookupToken()
+	if err != nil {
+		log.Errorf("Vault token lookup error:%s", err)
+		if login == nil {
+			return
+		}
+		secret = v.relogin(login)
+	}
+	for {
+		ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second
+		v.token.set(ttl)
+		if ttl == 0 {
+			log.Infof("Vault token does not expire")
+			return
+		}
+		if err := v.renewToken(secret); err != nil {
+			log.Warnf("Vault token renewal stopped, error:%s", err)
+		}
+		if login == nil {
+			log.Errorf("Vault token can't be renewed and expires at:%s, use -authPath to log in again", v.TokenExpiry().Format(time.RFC3339))
+			return
+		}
+		secret = v.relogin(login)
+	}
+}
+
+// renewToken renews the token until it reaches max ttl, a token that is not renewable is
+// kept for 2/3 of its ttl.
+func (v *Vault) renewToken(secret *api.Secret) error {
+	if !secret.Auth.Renewable {
+		time.Sleep(time.Duration(secret.Auth.LeaseDuration) * time.Second * 2 / 3)
+		return nil
+	}
+	renewer, err := v.api.Client().NewRenewer(&api.RenewerInput{Secret: secret})
+	if err != nil {
+		return err
+	}
+	go renewer.Renew()
+	defer renewer.Stop()
+	for {
+		select {
+		case err := <-renewer.DoneCh():
+			return err
+		case renewal := <-renewer.RenewCh():
+			if renewal.Secret != nil && renewal.Secret.Auth != nil {
+				ttl := time.Duration(renewal.Secret.Auth.LeaseDuration) * time.Second
+				v.token.set(ttl)
+				log.Debugf("Renewed vault token, ttl:%s", ttl)
+			}
+		}
+	}
+}
+
+// relogin logs in until it succeeds and sets the new token.
+func (v *Vault) relogin(login LoginFunc) *api.Secret {
+	delay := loginRetryDelay
+	for {
+		secret, err := login()
+		if err == nil {
+			log.Infof("Logged in to vault again")
+			v.api.Client().SetToken(secret.Auth.ClientToken)
+			return secret
+		}
+		log.Errorf("Vault login error:%s, retry in:%s", err, delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > loginRetryMaxDelay {
+			delay = loginRetryMaxDelay
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package vault
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// undo compensates a vault change made by a step.
+type undo func() error
+
+// step is a single bind action, it returns undo only if it created something in vault.
+type step struct {
+	name string
+	path string
+	do   func() (undo, error)
+}
+
+type undoEntry struct {
+	step
+	undo undo
+}
+
+// transaction runs steps in order and on failure undoes changes of the completed steps in reverse order.
+type transaction struct {
+	steps []step
+}
+
+func (t *transaction) add(name, path string, do func() (undo, error)) *transaction {
+	t.steps = append(t.steps, step{name, path, do})
+	return t
+}
+
+func (t *transaction) run() error {
+	var undos []undoEntry
+	for _, s := range t.steps {
+		u, err := s.do()
+		if err != nil {
+			log.Errorf("Step:%s path:%s failed, rolling back %d changes", s.name, s.path, len(undos))
+			rollback(undos)
+			return stepError(s.name, s.path, err)
+		}
+		if u != nil {
+			undos = append(undos, undoEntry{s, u})
+		}
+	}
+	return nil
+}
+
+func rollback(undos []undoEntry) {
+	for i := len(undos) - 1; i >= 0; i-- {
+		u := undos[i]
+		log.Infof("Rolling back step:%s path:%s", u.name, u.path)
+		if err := u.undo(); err != nil {
+			log.Errorf("Rollback step:%s path:%s error:%s", u.name, u.path, err)
+		}
+	}
+}
+
+func (v *Vault) deletePath(path string) undo {
+	return func() error {
+		_, err := v.api.Client().Logical().Delete(path)
+		return err
+	}
+}
+
+func (v *Vault) writePath(path string, data VaultData) undo {
+	return func() error {
+		_, err := v.api.Client().Logical().Write(path, data)
+		return err
+	}
+}
@@ -0,0 +1,56 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTransactionRollback(t *testing.T) {
+	tests := []struct {
+		name   string
+		fail   int
+		undone []string
+	}{
+		{"no failure", -1, nil},
+		{"first step", 0, nil},
+		{"after created and synced steps", 3, []string{"c", "a"}},
+		{"failing undo continues", 4, []string{"d", "c", "a"}},
+	}
+	for _, test := range tests {
+		var undone []string
+		created := func(name string, undoErr error) func() (undo, error) {
+			return func() (undo, error) {
+				return func() error {
+					undone = append(undone, name)
+					return undoErr
+				}, nil
+			}
+		}
+		synced := func() (undo, error) { return nil, nil }
+		tx := new(transaction).
+			add("a", "a", created("a", nil)).
+			add("b", "b", synced).
+			add("c", "c", created("c", nil)).
+			add("d", "d", created("d", fmt.Errorf("undo failed"))).
+			add("e", "e", synced)
+		if test.fail >= 0 {
+			tx.steps[test.fail].do = func() (undo, error) { return nil, fmt.Errorf("step failed") }
+		}
+		err := tx.run()
+		if test.fail < 0 {
+			if err != nil {
+				t.Errorf("%s: error:%s", test.name, err)
+			}
+		} else {
+			var stepErr *StepError
+			if !errors.As(err, &stepErr) || stepErr.Step != tx.steps[test.fail].name {
+				t.Errorf("%s: error:%v want step:%s", test.name, err, tx.steps[test.fail].name)
+			}
+		}
+		if !reflect.DeepEqual(undone, test.undone) {
+			t.Errorf("%s: undone:%v want:%v", test.name, undone, test.undone)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package vault
 
 import (
+	"fmt"
 	"html/template"
-	"io/ioutil"
+	"net/http"
 	"os"
 	"regexp"
 
@@ -21,6 +22,13 @@ type Vault struct {
 	policyTmpl      *template.Template
 	secretsPathTmpl *template.Template
 	authTmpl        *template.Template
+	policies        *PolicyTemplates
+	groupProviders  []GroupProvider
+	groups          *groupLocks
+	token           *tokenState
+	namespace       string
+	namespaceTmpl   *template.Template
+	tls             *TLSFiles
 	addr            string
 	kubeTokenPath   string
 }
@@ -39,6 +47,8 @@ func New(addr, policyTmpl, secretsPathTmpl, authTmpl string) *Vault {
 	v := new(Vault)
 	v.addr = addr
 	v.api = new(VaultApi)
+	v.groups = new(groupLocks)
+	v.token = &tokenState{err: fmt.Errorf("not connected")}
 	policyT, err := template.New("policy").Parse(policyTmpl)
 	if err != nil {
 		log.Fatalf("Policy template parser error:%s", err)
@@ -54,6 +64,30 @@ func New(addr, policyTmpl, secretsPathTmpl, authTmpl string) *Vault {
 		log.Fatalf("Auth template parser error:%s", err)
 	}
 	v.secretsPathTmpl = secretsPathT
+	policies, err := NewPolicyTemplates(nil)
+	if err != nil {
+		log.Fatalf("Policy tier template parser error:%s", err)
+	}
+	v.policies = policies
+	v.groupProviders, _ = ParseGroupProviders("okta,oidc")
+	return v
+}
+
+// SetGroupProviders replaces default okta and oidc group providers.
+func (v *Vault) SetGroupProviders(providers []GroupProvider) *Vault {
+	v.groupProviders = providers
+	return v
+}
+
+// SetTLS sets TLS files of the vault client, it must be called before Start.
+func (v *Vault) SetTLS(tls *TLSFiles) *Vault {
+	v.tls = tls
+	return v
+}
+
+// SetPolicyTemplates replaces built-in policy tiers.
+func (v *Vault) SetPolicyTemplates(policies *PolicyTemplates) *Vault {
+	v.policies = policies
 	return v
 }
 
@@ -62,40 +96,55 @@ func (v *Vault) Ping() error {
 	return err
 }
 
-func (v *Vault) SetToken(unwrap bool, vaultToken string) {
+func (v *Vault) setToken(unwrap bool, vaultToken string) error {
 	var token string
 	if len(vaultToken) > 0 {
 		token = vaultToken
 	} else {
 		token = os.Getenv("VAULT_TOKEN")
-		if len(token) > 0 {
-			log.Debugf("Using token from environment variable VAULT_TOKEN")
-		} else {
-			log.Errorf("No token provided")
-			os.Exit(1)
+		if len(token) == 0 {
+			return fmt.Errorf("no token provided")
 		}
+		log.Debugf("Using token from environment variable VAULT_TOKEN")
 	}
 	if !unwrap {
 		v.api.Client().SetToken(token)
-		return
+		return nil
 	}
 	re, err := v.api.Client().Logical().Unwrap(token)
 	if err != nil {
-		log.Errorf("Can't unwrap token:%s, error:%s", token, err)
-		os.Exit(1)
+		return fmt.Errorf("can't unwrap token, error:%s", err)
+	}
+	if re == nil || re.Auth == nil {
+		return fmt.Errorf("no auth data in unwrapped token")
 	}
 	v.api.Client().SetToken(re.Auth.ClientToken)
+	return nil
 }
 
-func (v *Vault) Connect() *Vault {
+func (v *Vault) connect() error {
 	log.Debugf("Connecting to vault addr:%s", v.addr)
-	c, err := api.NewClient(&api.Config{Address: v.addr})
+	config := api.DefaultConfig()
+	if len(v.addr) > 0 {
+		config.Address = v.addr
+	}
+	if v.tls != nil {
+		tlsConfig, err := v.tls.config(config.Address)
+		if err != nil {
+			return fmt.Errorf("TLS config error:%s", err)
+		}
+		config.HttpClient.Transport.(*http.Transport).TLSClientConfig = tlsConfig
+	}
+	c, err := api.NewClient(config)
 	if err != nil {
-		log.Errorf("Failed to connect to vault addr:%s, error:%s", v.addr, err)
-		os.Exit(1)
+		return err
+	}
+	if len(v.namespace) > 0 {
+		log.Infof("Using vault namespace:%s", v.namespace)
+		c.SetNamespace(v.namespace)
 	}
 	v.api.SetClient(c)
-	return v
+	return nil
 }
 
 func parseAuthPath(kubeAuth string) (role string, path string) {
@@ -106,18 +155,3 @@ func parseAuthPath(kubeAuth string) (role string, path string) {
 		return "default", kubeAuth
 	}
 }
-
-func (v *Vault) KubeAuth(kubeTokenPath, kubeAuth string) string {
-	role, path := parseAuthPath(kubeAuth)
-	jwt, err := ioutil.ReadFile(kubeTokenPath)
-	if err != nil {
-		log.Errorf("Can't read jwt token at %s", v.kubeTokenPath)
-		os.Exit(1)
-	}
-	re, err := v.api.Client().Logical().Write("auth/"+path+"/login", map[string]interface{}{"role": role, "jwt": string(jwt)})
-	if err != nil {
-		log.Errorf("Can't authenticate jwt token path:%s, role:%s, error:%s", path, role, err)
-		os.Exit(1)
-	}
-	return re.Auth.ClientToken
-}